@@ -17,23 +17,35 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	cdnv1alpha1 "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
 	"gitlab.com/redcoat/cdn-manager/pkg/controller"
 	"gitlab.com/redcoat/cdn-manager/pkg/indexer"
+	"gitlab.com/redcoat/cdn-manager/pkg/metrics"
+	"gitlab.com/redcoat/cdn-manager/pkg/standalone"
+	"gitlab.com/redcoat/cdn-manager/pkg/tracing"
+	"gitlab.com/redcoat/cdn-manager/pkg/util"
+	"gitlab.com/redcoat/cdn-manager/pkg/webhook"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -53,13 +65,59 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
-	var ingressService string
+	var ingressOpts controller.IngressOptions
+	var ingressClassServices string
+	var watchNamespaces string
+	var watchSelector string
+	var enableWebhooks bool
+	var distributionOpts controller.DistributionOptions
+	var tracingOpts tracing.Options
+	var standaloneDir string
+	var standaloneConfigMap string
+	var stateSecret string
+	var stateFile string
+	var standaloneResync time.Duration
+	var allowEmptyBundle bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
-	flag.StringVar(&ingressService, "ingress-service", "", "The service of the ingress controller to use.")
+	flag.StringVar(&ingressOpts.Service, "ingress-service", "", "The service of the ingress controller to use.")
+	flag.StringVar(&ingressClassServices, "ingress-class-services", "",
+		"A comma separated list of <ingress class>=<namespace>/<name> pairs, giving the service of the ingress controller for each IngressClass.")
+	flag.BoolVar(&ingressOpts.PublishEndpoints, "publish-endpoints", false,
+		"Annotate Ingresses with the endpoints and readiness of their Distributions.")
+	flag.BoolVar(&ingressOpts.PublishStatus, "publish-ingress-status", false,
+		"Rewrite Ingresses' load balancer status to point at their Distributions once they are ready, eg for external-dns.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"A comma separated list of namespaces to create Distributions for Ingresses, Services, HTTPRoutes, Routes and VirtualServices in. Defaults to all namespaces.")
+	flag.StringVar(&watchSelector, "watch-selector", "",
+		"A label selector limiting which Ingresses, Services, HTTPRoutes, Routes and VirtualServices Distributions are created for.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the defaulting and validating admission webhooks. This requires a serving certificate.")
+	flag.BoolVar(&distributionOpts.DryRun, "dry-run", false,
+		"Only plan changes to external distributions, recording them in each Distribution's status without applying them.")
+	flag.Float64Var(&distributionOpts.AwsRateLimit.Rate, "aws-rate-limit", 5,
+		"The number of AWS API calls per second allowed for each AWS account. Set to 0 to disable the limit.")
+	flag.IntVar(&distributionOpts.AwsRateLimit.Burst, "aws-rate-burst", 10,
+		"The number of AWS API calls which can be made in a burst, above the rate limit.")
+	flag.StringVar(&tracingOpts.Endpoint, "otlp-endpoint", "",
+		"The host:port of an OTLP gRPC collector to send traces to. Tracing is disabled if this is not set.")
+	flag.BoolVar(&tracingOpts.Insecure, "otlp-insecure", false, "Connect to the OTLP collector without TLS.")
+	flag.Float64Var(&tracingOpts.SampleRatio, "trace-sample-ratio", 1, "The fraction of reconciliations to trace, between 0 and 1.")
+	flag.StringVar(&standaloneDir, "standalone-dir", "",
+		"Run without the CRDs, reading Distributions and DistributionClasses from the YAML files in this directory.")
+	flag.StringVar(&standaloneConfigMap, "standalone-configmap", "",
+		"Run without the CRDs, reading Distributions and DistributionClasses from the ConfigMap with this <namespace>/<name>.")
+	flag.StringVar(&stateSecret, "state-secret", "",
+		"The <namespace>/<name> of the Secret to keep the provider state of standalone Distributions in.")
+	flag.StringVar(&stateFile, "state-file", "",
+		"The file to keep the provider state of standalone Distributions in, instead of a Secret.")
+	flag.DurationVar(&standaloneResync, "standalone-resync", 10*time.Minute,
+		"How often to reload the standalone bundle and reconcile all of its Distributions.")
+	flag.BoolVar(&allowEmptyBundle, "allow-empty-bundle", false,
+		"Allow a standalone bundle without any Distributions to delete all of the ones in the state, rather than keeping the last bundle.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -69,6 +127,15 @@ func main() {
 	log := zap.New(zap.UseFlagOptions(&opts))
 	ctrl.SetLogger(log)
 
+	ctx := ctrl.SetupSignalHandler()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -82,15 +149,80 @@ func main() {
 		os.Exit(1)
 	}
 
-	indexer.SetUpDistributionIndexers(mgr)
+	if standaloneDir != "" || standaloneConfigMap != "" {
+		bundle, err := newStandaloneClient(mgr, log, standaloneDir, standaloneConfigMap, stateSecret, stateFile, standaloneResync, allowEmptyBundle)
+		if err != nil {
+			setupLog.Error(err, "invalid standalone options")
+			os.Exit(1)
+		}
+		if err = metrics.RegisterDistributionCollector(bundle); err != nil {
+			setupLog.Error(err, "unable to register metrics")
+			os.Exit(1)
+		}
+		if err = controller.NewStandaloneDistributionController(mgr, bundle, log, distributionOpts); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Distribution")
+			os.Exit(1)
+		}
+		setupLog.Info("Running in standalone mode. Only Distributions in the bundle will be reconciled")
+	} else {
+		indexer.SetUpDistributionIndexers(mgr)
 
-	if err = controller.NewDistributionController(mgr, log); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Distribution")
-		os.Exit(1)
-	}
-	if err = controller.NewIngressController(mgr, ingressService); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Distribution")
-		os.Exit(1)
+		if err = metrics.RegisterDistributionCollector(mgr.GetClient()); err != nil {
+			setupLog.Error(err, "unable to register metrics")
+			os.Exit(1)
+		}
+
+		if err = controller.NewDistributionController(mgr, log, distributionOpts); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Distribution")
+			os.Exit(1)
+		}
+		ingressOpts.ClassServices, err = util.ObjectKeyMapFromString(ingressClassServices)
+		if err != nil {
+			setupLog.Error(err, "invalid --ingress-class-services")
+			os.Exit(1)
+		}
+		ingressOpts.Filter.Namespaces = util.SplitList(watchNamespaces)
+		if watchSelector != "" {
+			if ingressOpts.Filter.Selector, err = labels.Parse(watchSelector); err != nil {
+				setupLog.Error(err, "invalid --watch-selector")
+				os.Exit(1)
+			}
+		}
+
+		if err = controller.NewIngressController(mgr, ingressOpts); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Distribution")
+			os.Exit(1)
+		}
+		if err = controller.NewServiceController(mgr, ingressOpts.Filter); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Service")
+			os.Exit(1)
+		}
+		if controller.GatewayAPIInstalled(mgr) {
+			if err = controller.NewHTTPRouteController(mgr, ingressOpts.Filter); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "HTTPRoute")
+				os.Exit(1)
+			}
+		} else {
+			setupLog.Info("Gateway API is not installed. HTTPRoutes will not be watched")
+		}
+		if controller.OpenShiftRoutesInstalled(mgr) {
+			if err = controller.NewRouteController(mgr, ingressOpts.Filter); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "Route")
+				os.Exit(1)
+			}
+		}
+		if controller.IstioInstalled(mgr) {
+			if err = controller.NewVirtualServiceController(mgr, ingressOpts.Filter); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "VirtualService")
+				os.Exit(1)
+			}
+		}
+		if enableWebhooks {
+			if err = webhook.Register(mgr); err != nil {
+				setupLog.Error(err, "unable to register webhooks")
+				os.Exit(1)
+			}
+		}
 	}
 	//+kubebuilder:scaffold:builder
 
@@ -104,8 +236,59 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// Creates the standalone.Client for the bundle in the given directory or
+// ConfigMap, keeping its state in the given Secret or file
+func newStandaloneClient(
+	mgr ctrl.Manager,
+	log logr.Logger,
+	dir, configMap, stateSecret, stateFile string,
+	resync time.Duration,
+	allowEmpty bool,
+) (*standalone.Client, error) {
+	var source standalone.Source
+	switch {
+	case dir != "" && configMap != "":
+		return nil, fmt.Errorf("only one of --standalone-dir and --standalone-configmap can be given")
+	case dir != "":
+		source = standalone.DirectorySource{Path: dir}
+	case !strings.Contains(configMap, "/"):
+		return nil, fmt.Errorf("--standalone-configmap must be in the form <namespace>/<name>")
+	default:
+		source = standalone.ConfigMapSource{
+			Client: mgr.GetAPIReader(),
+			Key:    *util.ObjectKeyFromString(configMap),
+		}
+	}
+
+	var store standalone.Store
+	switch {
+	case stateSecret != "" && stateFile != "":
+		return nil, fmt.Errorf("only one of --state-secret and --state-file can be given")
+	case stateFile != "":
+		store = standalone.FileStore{Path: stateFile}
+	case !strings.Contains(stateSecret, "/"):
+		return nil, fmt.Errorf("--state-secret must be given, in the form <namespace>/<name>, or --state-file")
+	default:
+		// Loading the state must see the last save, so this does not
+		// go through the manager's cache
+		c, err := client.New(mgr.GetConfig(), client.Options{
+			Scheme: mgr.GetScheme(),
+			Mapper: mgr.GetRESTMapper(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		store = standalone.SecretStore{
+			Client: c,
+			Key:    *util.ObjectKeyFromString(stateSecret),
+		}
+	}
+
+	return standalone.NewClient(mgr.GetClient(), source, store, resync, allowEmpty, log.WithName("standalone")), nil
+}
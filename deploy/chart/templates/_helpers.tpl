@@ -60,3 +60,11 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Whether the admission webhooks are served. They are not used in
+standalone mode, as there are no CRDs to admit.
+*/}}
+{{- define "cdn-manager.webhookEnabled" -}}
+{{- if and .Values.webhook.enabled (not .Values.standalone.enabled) }}true{{ end }}
+{{- end }}
@@ -0,0 +1,44 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Annotations which can be set on Distribution resources to control the
+// behaviour of the controller
+const (
+	// If set, a change which has been rolled out to a staging
+	// distribution is promoted to the primary distribution as soon as it
+	// has deployed. The controller removes this annotation once the
+	// rollout has completed.
+	AnnotationPromote = "cdn.redcoat.dev/promote"
+
+	// An alternative to spec.adopt.externalId. If both are given, the
+	// spec takes precedence.
+	AnnotationAdopt = "cdn.redcoat.dev/adopt"
+
+	// An alternative to spec.adopt.policy, for use with the adopt
+	// annotation
+	AnnotationAdoptionPolicy = "cdn.redcoat.dev/adoption-policy"
+
+	// If set, the controller works out what it would change in the
+	// external provider and reports it in the status, but does not make
+	// any changes
+	AnnotationPlanOnly = "cdn.redcoat.dev/plan-only"
+
+	// If set, the controller keeps the status up to date but does not
+	// make any changes to the external provider, until it is removed
+	AnnotationPaused = "cdn.redcoat.dev/paused"
+)
@@ -18,6 +18,8 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
 )
 
 func init() {
@@ -73,16 +75,66 @@ type DistributionSpec struct {
 	// the TLS certificate, and how to handle insecure requests).
 	// +optional
 	TLS *TLSSpec `json:"tls"`
+
+	// If this block is given, viewers must use signed URLs or signed
+	// cookies to access the distribution.
+	// +optional
+	SignedURLs *SignedURLSpec `json:"signedUrls,omitempty"`
+
+	// If this block is given, changes to the distribution are first
+	// rolled out to a staging distribution, which receives a portion of
+	// the traffic, before being promoted to the primary distribution.
+	// +optional
+	Rollout *RolloutSpec `json:"rollout,omitempty"`
+
+	// If this block is given, the controller takes ownership of an
+	// existing distribution in the external provider, rather than
+	// creating a new one.
+	// +optional
+	Adopt *AdoptSpec `json:"adopt,omitempty"`
+
+	// What to do with the distribution in the external provider when this
+	// resource is deleted. "Delete" removes it. "Retain" leaves it, and
+	// its supporting resources, exactly as they are. "Disable" leaves it
+	// in place, but stops it from serving traffic. If not given, the
+	// DistributionClass's deletion policy is used.
+	// +kubebuilder:validation:Enum=Delete;Retain;Disable
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// The id of the CDN provider's cache policy to use for this
+	// distribution. If given, this takes precedence over the
+	// DistributionClass's cache policy.
+	// +optional
+	CachePolicyId string `json:"cachePolicyId,omitempty"`
 }
 
+type DeletionPolicy string
+
+const (
+	DeletionPolicyDelete  DeletionPolicy = "Delete"
+	DeletionPolicyRetain  DeletionPolicy = "Retain"
+	DeletionPolicyDisable DeletionPolicy = "Disable"
+)
+
 // Options for the "origin" of the distribition - ie where the CDN
 // points to.
 type Origin struct {
 	// If you specify this, this takes precendence over any detected
 	// ingress load balancer hostnames. Use this to override the target's
-	// hostname, or if you have not specified a kubernetes target.
+	// hostname, or if you have not specified a kubernetes target. This is
+	// ignored for S3 origins.
+	// +optional
 	Host string `json:"host"`
 
+	// An Ingress, Service (of type LoadBalancer) or Gateway in the same
+	// namespace, whose load balancer address is used as the origin's
+	// host. The address is looked up each time the Distribution is
+	// reconciled, so changes to it are picked up automatically. This is
+	// ignored if host is given.
+	// +optional
+	TargetRef *ObjectReference `json:"targetRef,omitempty"`
+
 	// The port to target for HTTP requests. If not given, this defaults
 	// to 80.
 	// +kubebuilder:default=80
@@ -94,6 +146,27 @@ type Origin struct {
 	// +kubebuilder:default=443
 	// +optional
 	HTTPSPort int32 `json:"httpsPort"`
+
+	// If this block is given, the origin is an S3 bucket rather than a
+	// web server. This is typically used to serve static sites (eg
+	// SPAs). The Host and port settings are ignored.
+	// +optional
+	S3 *S3Origin `json:"s3,omitempty"`
+}
+
+// Options for an S3 bucket origin
+type S3Origin struct {
+	// The name of the S3 bucket
+	BucketName string `json:"bucketName"`
+
+	// The AWS region that the bucket lives in, eg eu-west-2
+	Region string `json:"region"`
+
+	// If true, the bucket's policy will be updated to allow the
+	// distribution read access to its objects. If false, you will need
+	// to grant access yourself.
+	// +optional
+	ManageBucketPolicy bool `json:"manageBucketPolicy,omitempty"`
 }
 
 // Options to control the way TLS works within this distribution
@@ -111,14 +184,182 @@ type TLSSpec struct {
 	// The name of the kubernetes secret containing the TLS certificate
 	// to be used by the distribution. This should be of type
 	// kubernetes.io/tls and have the required fields (tls.crt and
-	// tls.key). Other fields are ignored.
+	// tls.key). Other fields are ignored. This is required unless
+	// certificateRef is given.
+	// +optional
 	SecretRef string `json:"secretName"`
+
+	// A resource in the same namespace which holds the TLS certificate
+	// inline, rather than in a secret. Only OpenShift Routes (with a
+	// certificate and key in spec.tls) are currently supported. If given,
+	// secretName is ignored.
+	// +optional
+	CertificateRef *ObjectReference `json:"certificateRef,omitempty"`
+}
+
+// Options to require viewers to use signed URLs or signed cookies
+type SignedURLSpec struct {
+	// The name of the kubernetes secret containing the RSA key pair used
+	// to sign URLs. The private key must be saved in the "private.pem"
+	// field. If there is also a "public.pem" field, it is used as the
+	// public key, otherwise the public key is derived from the private
+	// key. Only the public key is uploaded to the CDN provider.
+	SecretRef string `json:"secretName"`
+
+	// The name of the ConfigMap that the signing key's identifier is
+	// published to (in the "keyPairId" field), for use by applications
+	// that sign URLs. If not given, this defaults to
+	// "<distribution name>-signing".
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// When the key pair in the secret is changed, the previous key will
+	// continue to be trusted for this long, giving applications time to
+	// switch to the new key. If not given, this defaults to 1h. At most
+	// 5 keys are trusted at once, so the oldest may be dropped sooner.
+	// +optional
+	RotationGracePeriod *metav1.Duration `json:"rotationGracePeriod,omitempty"`
+}
+
+// Options to control how changes are rolled out via a staging
+// distribution. Exactly one of Header or WeightPercent should be set.
+type RolloutSpec struct {
+	// Requests with this header (and value) are sent to the staging
+	// distribution.
+	// +optional
+	Header *RolloutHeader `json:"header,omitempty"`
+
+	// The percentage of requests which are sent to the staging
+	// distribution. NB: CloudFront supports at most 15%.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=15
+	// +optional
+	WeightPercent int32 `json:"weightPercent,omitempty"`
+
+	// How long the staging distribution must be deployed before the
+	// change is automatically promoted to the primary distribution. If
+	// not given, changes are only promoted when the
+	// cdn.redcoat.dev/promote annotation is set on the Distribution.
+	// +optional
+	SoakTime *metav1.Duration `json:"soakTime,omitempty"`
+
+	// If the staging distribution has not finished deploying within this
+	// time, the rollout is aborted. If not given, this defaults to 30m.
+	// +optional
+	DeployTimeout *metav1.Duration `json:"deployTimeout,omitempty"`
 }
 
+// A header used to route requests to the staging distribution
+type RolloutHeader struct {
+	// The name of the header. For CloudFront, this must begin with
+	// "aws-cf-cd-".
+	Name string `json:"name"`
+
+	// The value the header must have
+	Value string `json:"value"`
+}
+
+// The phases of a rollout
+const (
+	// The change is being deployed to the staging distribution
+	RolloutDeploying = "Deploying"
+
+	// The change has been deployed to the staging distribution and is
+	// waiting to be promoted
+	RolloutSoaking = "Soaking"
+
+	// The staging distribution failed to deploy the change, so it will
+	// not be promoted
+	RolloutAborted = "Aborted"
+)
+
+// The state of an in progress rollout
+type RolloutStatus struct {
+	// One of Deploying, Soaking or Aborted
+	Phase string `json:"phase"`
+
+	// The external provider's identifier for the staging distribution
+	StagingId string `json:"stagingId"`
+
+	// The endpoint of the staging distribution, which can be used to
+	// test the change directly
+	// +optional
+	StagingEndpoint string `json:"stagingEndpoint,omitempty"`
+
+	// When the change started being rolled out to the staging
+	// distribution
+	StartedAt metav1.Time `json:"startedAt"`
+
+	// When the change finished deploying to the staging distribution
+	// +optional
+	DeployedAt *metav1.Time `json:"deployedAt,omitempty"`
+
+	// Further details, such as the reason a rollout was aborted
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Options for adopting a distribution which was created outside of the
+// controller (eg by Terraform)
+type AdoptSpec struct {
+	// The external provider's Identifier for the distribution to adopt
+	ExternalId string `json:"externalId"`
+
+	// What to do with any differences between the adopted distribution
+	// and this resource. "Converge" updates the distribution to match.
+	// "Observe" only reports the differences in the status, and never
+	// changes or deletes the distribution.
+	// +kubebuilder:validation:Enum=Converge;Observe
+	// +kubebuilder:default=Converge
+	// +optional
+	Policy AdoptionPolicy `json:"policy,omitempty"`
+}
+
+type AdoptionPolicy string
+
+const (
+	AdoptionConverge AdoptionPolicy = "Converge"
+	AdoptionObserve  AdoptionPolicy = "Observe"
+)
+
+// Condition types set on Distributions
+const (
+	// The Distribution is fully in its desired state
+	ConditionReady = "Ready"
+
+	// The TLS certificate (if any) has been loaded
+	ConditionCertificateReady = "CertificateReady"
+
+	// The Distribution has an origin to point at
+	ConditionOriginResolved = "OriginResolved"
+
+	// The provider has successfully applied the Distribution's settings
+	ConditionProviderSynced = "ProviderSynced"
+
+	// The external distribution has finished deploying its latest
+	// changes
+	ConditionDeployed = "Deployed"
+
+	// The Distribution is being deleted
+	ConditionDeleting = "Deleting"
+)
+
 // The current State of the Distribution
 type DistributionStatus struct {
 	Ready bool `json:"ready"`
 
+	// The generation of the Distribution which was last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// The latest observations of the Distribution's state
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
 	// List of one or more "endpoints" for the deployed distribution.
 	// These can be either hostnames for DNS CNAMING, or direct IP
 	// addresses, depending on the provider.
@@ -134,9 +375,51 @@ type DistributionStatus struct {
 	// +optional
 	ExternalCertificateId string `json:"externalCertificateId"`
 
+	// If signed URLs are required, this is the external provider's
+	// identifier for the current signing key (eg CloudFront's Key Pair
+	// Id)
+	// +optional
+	SigningKeyId string `json:"signingKeyId,omitempty"`
+
 	// A status message from the external provider
 	// +optional
 	ExternalStatus string `json:"externalStatus,omitempty"`
+
+	// The fields of the external distribution which differ from this
+	// resource, and have not yet been (or, for observed distributions,
+	// will not be) updated
+	// +optional
+	PendingChanges []string `json:"pendingChanges,omitempty"`
+
+	// The fields of the external distribution which have been changed
+	// outside of the controller since it last matched this resource
+	// +optional
+	Drift []string `json:"drift,omitempty"`
+
+	// If changes are being held back until the DistributionClass's
+	// maintenance window, this is when it next opens
+	// +optional
+	NextMaintenanceWindow *metav1.Time `json:"nextMaintenanceWindow,omitempty"`
+
+	// If the Distribution is in plan-only mode or paused, this describes
+	// the changes which would be made to the external provider
+	// +optional
+	Plan []string `json:"plan,omitempty"`
+
+	// Details of the rollout of a change via a staging distribution, if
+	// one is in progress
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// Provider specific state which does not fit into the generic fields
+	// above (eg the identifiers of supporting resources)
+	// +optional
+	Providers ProviderStatusList `json:"providers,omitempty"`
+}
+
+type ProviderStatusList struct {
+	// +optional
+	CloudFront *cfapi.CloudFrontStatus `json:"cloudfront,omitempty"`
 }
 
 // Information about a specific Endpoint
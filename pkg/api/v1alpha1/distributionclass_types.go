@@ -60,8 +60,52 @@ type ClusterDistributionClass struct {
 // resource
 type DistributionClassSpec struct {
 	Providers ProviderList `json:"providers"`
+
+	// The default deletion policy for Distributions using this class
+	// which do not specify their own.
+	// +kubebuilder:validation:Enum=Delete;Retain;Disable
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// What to do when an external distribution has been changed outside
+	// of the controller. "Correct" puts it back to match its
+	// Distribution, "Report" lists the changes in the Distribution's
+	// status and "Ignore" leaves them in place. Changes to the
+	// Distribution itself are always applied.
+	// +kubebuilder:validation:Enum=Correct;Report;Ignore
+	// +kubebuilder:default=Correct
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// If set, changes to existing distributions are only applied during
+	// this window. Outside of it, they are listed in each Distribution's
+	// status.pendingChanges field. Certificate renewals are always
+	// applied straight away.
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
 }
 
+// A recurring period of time during which changes can be made
+type MaintenanceWindow struct {
+	// A cron expression for when the window opens, eg "0 2 * * *" for
+	// 2am every day. Times are in UTC, unless the expression starts with
+	// CRON_TZ=<zone>.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// How long the window stays open for
+	Duration metav1.Duration `json:"duration"`
+}
+
+type DriftPolicy string
+
+const (
+	DriftPolicyCorrect DriftPolicy = "Correct"
+	DriftPolicyReport  DriftPolicy = "Report"
+	DriftPolicyIgnore  DriftPolicy = "Ignore"
+)
+
 type ProviderList struct {
 	// If this block exists, Distributions referencing this
 	// DistributionClass will be setup in CloudFront. You can specify an
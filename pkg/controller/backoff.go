@@ -0,0 +1,128 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/provider"
+)
+
+const (
+	// How often to check on a Distribution which is not ready, when
+	// there is no better idea of when it might be
+	defaultPollInterval = time.Minute
+
+	// The limits on how often to check on a change which is being
+	// deployed
+	minPollInterval = 30 * time.Second
+	maxPollInterval = 5 * time.Minute
+)
+
+// Tracks how long to wait before retrying each Distribution after a
+// provider error
+//
+// Each class of error backs off exponentially, and separately for each
+// Distribution, until a provider call for it succeeds.
+type errorBackoff map[provider.ErrorClass]workqueue.RateLimiter
+
+func newErrorBackoff() errorBackoff {
+	return errorBackoff{
+		provider.ErrorThrottled:     workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 5*time.Minute),
+		provider.ErrorConflict:      workqueue.NewItemExponentialFailureRateLimiter(time.Second, time.Minute),
+		provider.ErrorQuotaExceeded: workqueue.NewItemExponentialFailureRateLimiter(5*time.Minute, time.Hour),
+		provider.ErrorInvalidConfig: workqueue.NewItemExponentialFailureRateLimiter(time.Minute, 30*time.Minute),
+	}
+}
+
+// Sets the result to retry the Distribution after the given error
+//
+// Errors which have not been classified are requeued immediately, which
+// leaves the controller's own rate limiting to space them out.
+func (b errorBackoff) retry(result *ctrl.Result, key client.ObjectKey, err error) {
+	limiter, ok := b[provider.ClassOf(err)]
+	if !ok {
+		result.Requeue = true
+		return
+	}
+
+	result.RequeueAfter = limiter.When(key)
+}
+
+// Resets the backoff for the Distribution, once a provider call for it
+// has succeeded
+func (b errorBackoff) reset(key client.ObjectKey) {
+	for _, limiter := range b {
+		limiter.Forget(key)
+	}
+}
+
+// Works out how long to wait before checking on a Distribution which is
+// not yet ready
+//
+// If its changes are waiting for a maintenance window, there is no point
+// checking before it opens. If they are being deployed, this is based
+// on how long that has been going on for.
+func reconcilePollInterval(status *api.DistributionStatus) time.Duration {
+	if next := status.NextMaintenanceWindow; next != nil {
+		if until := time.Until(next.Time); until > defaultPollInterval {
+			return until
+		}
+		return defaultPollInterval
+	}
+
+	deployed := meta.FindStatusCondition(status.Conditions, api.ConditionDeployed)
+	if deployed == nil || deployed.Reason == "Deployed" {
+		return defaultPollInterval
+	}
+
+	return pollInterval(deployed.LastTransitionTime.Time)
+}
+
+// Works out how long to wait before checking on a Distribution which is
+// being deleted
+func deletePollInterval(status *api.DistributionStatus) time.Duration {
+	deleting := meta.FindStatusCondition(status.Conditions, api.ConditionDeleting)
+	if deleting == nil {
+		return defaultPollInterval
+	}
+
+	return pollInterval(deleting.LastTransitionTime.Time)
+}
+
+// Returns how long to wait before checking on a change which has been
+// in progress since the given time
+//
+// CloudFront changes normally take a few minutes to deploy, but some
+// take much longer, so this checks often at first and then less and
+// less often the longer it goes on.
+func pollInterval(since time.Time) time.Duration {
+	interval := time.Since(since) / 4
+	if interval < minPollInterval {
+		return minPollInterval
+	} else if interval > maxPollInterval {
+		return maxPollInterval
+	}
+
+	return interval
+}
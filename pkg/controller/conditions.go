@@ -0,0 +1,171 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// The conditions which must all be true for a Distribution to be Ready,
+// in the order they are checked
+var readyConditions = []string{
+	api.ConditionCertificateReady,
+	api.ConditionOriginResolved,
+	api.ConditionProviderSynced,
+	api.ConditionDeployed,
+}
+
+// Sets the given condition on the status
+//
+// The transition time is only updated if the condition's status has
+// changed, so this can safely be called on every reconciliation.
+func setCondition(
+	status *api.DistributionStatus,
+	generation int64,
+	conditionType string,
+	ok bool,
+	reason string,
+	message string,
+) {
+	conditionStatus := metav1.ConditionFalse
+	if ok {
+		conditionStatus = metav1.ConditionTrue
+	}
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// Sets the Ready condition to match the status' Ready flag
+//
+// If the Distribution is not ready, the reason and message are taken
+// from the first of the other conditions which is not true, so that the
+// Ready condition explains what is holding things up.
+func setReadyCondition(status *api.DistributionStatus, generation int64) {
+	if status.Ready {
+		setCondition(status, generation, api.ConditionReady, true, "Ready", "")
+		return
+	}
+
+	reason, message := "NotReady", ""
+	for _, conditionType := range readyConditions {
+		condition := meta.FindStatusCondition(status.Conditions, conditionType)
+		if condition != nil && condition.Status != metav1.ConditionTrue {
+			reason, message = condition.Reason, condition.Message
+			break
+		}
+	}
+
+	setCondition(status, generation, api.ConditionReady, false, reason, message)
+}
+
+// Sets the Deployed condition from the provider's view of the external
+// distribution
+func setDeployedCondition(status *api.DistributionStatus, generation int64) {
+	if status.Ready {
+		setCondition(status, generation, api.ConditionDeployed, true, "Deployed", "")
+	} else if rollout := status.Rollout; rollout != nil {
+		setCondition(status, generation, api.ConditionDeployed, false, "Rollout"+rollout.Phase, rollout.Message)
+	} else {
+		setCondition(status, generation, api.ConditionDeployed, false, "InProgress", "The external status is "+status.ExternalStatus)
+	}
+}
+
+// Returns why changes to the Distribution's external resources are
+// being held back, or an empty string if they are not
+//
+// Held Distributions are only planned: the providers refresh their
+// status, but do not change anything.
+func holdReason(dryRun bool, distro api.Distribution) string {
+	if _, ok := distro.Annotations[api.AnnotationPaused]; ok {
+		return "Paused"
+	}
+
+	if _, ok := distro.Annotations[api.AnnotationPlanOnly]; ok || dryRun {
+		return "PlanOnly"
+	}
+
+	return ""
+}
+
+// Sets the conditions following a successful plan of a held
+// Distribution
+//
+// Nothing has been applied, so the Distribution is only considered to
+// still be Ready if it was before and there is nothing left to change.
+func setHeldConditions(
+	status *api.DistributionStatus,
+	distro api.Distribution,
+	reason string,
+) {
+	if len(status.Plan) == 0 {
+		status.Ready = distro.Status.Ready
+		setCondition(status, distro.Generation, api.ConditionProviderSynced, true, "Synced", "")
+		return
+	}
+
+	status.Ready = false
+	setCondition(
+		status,
+		distro.Generation,
+		api.ConditionProviderSynced,
+		false,
+		reason,
+		fmt.Sprintf("%d changes planned but not applied", len(status.Plan)),
+	)
+}
+
+// Marks the provider as not synced if changes are waiting for the
+// DistributionClass's maintenance window to open
+func setMaintenanceWindowCondition(status *api.DistributionStatus, generation int64) {
+	next := status.NextMaintenanceWindow
+	if next == nil {
+		return
+	}
+
+	status.Ready = false
+	setCondition(
+		status,
+		generation,
+		api.ConditionProviderSynced,
+		false,
+		"OutsideMaintenanceWindow",
+		fmt.Sprintf(
+			"%d changes deferred until the maintenance window opens at %v",
+			len(status.PendingChanges),
+			next.UTC().Format(time.RFC3339),
+		),
+	)
+}
+
+// Marks the Distribution as being deleted, which means it is no longer
+// Ready
+func setDeletingCondition(status *api.DistributionStatus, generation int64, reason, message string) {
+	setCondition(status, generation, api.ConditionDeleting, true, reason, message)
+	setCondition(status, generation, api.ConditionReady, false, "Deleting", message)
+}
@@ -18,12 +18,17 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -31,9 +36,12 @@ import (
 
 	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
 	"gitlab.com/redcoat/cdn-manager/pkg/handler"
+	"gitlab.com/redcoat/cdn-manager/pkg/metrics"
 	"gitlab.com/redcoat/cdn-manager/pkg/provider"
 	"gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront"
+	"gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/auth"
 	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
+	"gitlab.com/redcoat/cdn-manager/pkg/tracing"
 )
 
 // The name of the finalizer used by this controller to manage the
@@ -53,6 +61,8 @@ const finalizer = "cdn.redcoat.dev/finalizer"
 // +kubebuilder:rbac:groups=cdn.redcoat.dev,resources=distributionclasses,verbs=get;watch;list
 // +kubebuilder:rbac:groups=cdn.redcoat.dev,resources=clusterdistributionclasses,verbs=get;watch;list
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;watch;list
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;create;update
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 type DistributionReconciler struct {
 	resolver.DistributionClassReader
@@ -61,9 +71,28 @@ type DistributionReconciler struct {
 	// settings
 	CertificateResolver resolver.CertificateResolver
 
+	// Used to load the key pair for distributions requiring signed URLs
+	SigningKeyResolver resolver.SigningKeyResolver
+
+	// Used to look up the origin host of distributions with a targetRef
+	TargetResolver resolver.TargetResolver
+
+	// The current scheme we are working with
+	Scheme *runtime.Scheme
+
 	// List of providers supported
 	Providers []provider.CDNProvider
 
+	// Used to record events against Distributions
+	Recorder record.EventRecorder
+
+	// Used to decide how long to wait before retrying after an error
+	Backoff errorBackoff
+
+	// If set, providers are only asked to plan their changes, which are
+	// recorded in the Distribution's status rather than being applied
+	DryRun bool
+
 	// The generic Logger interface for the reconciller
 	Logger logr.Logger
 
@@ -72,31 +101,79 @@ type DistributionReconciler struct {
 	log logr.Logger
 }
 
+// Options for the DistributionController, normally set from the
+// command line
+type DistributionOptions struct {
+	// See DistributionReconciler.DryRun
+	DryRun bool
+
+	// The client side limit on the rate of AWS API calls, which is
+	// shared by all Distributions using the same AWS account
+	AwsRateLimit auth.RateLimit
+}
+
 // SetupWithManager sets up the controller with the Manager.
-func NewDistributionController(mgr ctrl.Manager, logger logr.Logger) error {
+func NewDistributionController(
+	mgr ctrl.Manager,
+	logger logr.Logger,
+	opts DistributionOptions,
+) error {
 	client := mgr.GetClient()
 
-	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
-	if err != nil {
-		return err
-	}
-	cloudfront, err := cloudfront.New(clientset.CoreV1())
+	reconciler, err := newDistributionReconciler(mgr, client, logger, opts)
 	if err != nil {
 		return err
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).For(&api.Distribution{}).
+	builder := ctrl.NewControllerManagedBy(mgr).For(&api.Distribution{}).
 		Watches(handler.BuildIndexedReferenceWatcher(client, &api.DistributionClass{})).
 		Watches(handler.BuildIndexedReferenceWatcher(client, &api.ClusterDistributionClass{})).
 		Watches(handler.BuildIndexedReferenceWatcher(client, &corev1.Secret{})).
-		Complete(&DistributionReconciler{
-			DistributionClassReader: resolver.DistributionClassReader{Client: client},
-			Logger:                  logger.WithName("ctrl"),
-			CertificateResolver:     resolver.CertificateResolver{Client: client},
-			Providers: []provider.CDNProvider{
-				cloudfront,
-			},
-		})
+		Watches(handler.BuildIndexedReferenceWatcher(client, &networking.Ingress{})).
+		Watches(handler.BuildIndexedReferenceWatcher(client, &corev1.Service{}))
+	if GatewayAPIInstalled(mgr) {
+		builder = builder.Watches(handler.BuildUnstructuredReferenceWatcher(client, resolver.NewGateway()))
+	}
+	if OpenShiftRoutesInstalled(mgr) {
+		builder = builder.Watches(handler.BuildUnstructuredReferenceWatcher(client, resolver.NewRoute()))
+	}
+
+	return builder.Complete(reconciler)
+}
+
+// Creates a DistributionReconciler which reads and writes Distributions
+// using the given client
+func newDistributionReconciler(
+	mgr ctrl.Manager,
+	client client.Client,
+	logger logr.Logger,
+	opts DistributionOptions,
+) (*DistributionReconciler, error) {
+	recorder := mgr.GetEventRecorderFor("cdn-manager")
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	cloudfront, err := cloudfront.New(clientset.CoreV1(), recorder, opts.AwsRateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DistributionReconciler{
+		DistributionClassReader: resolver.DistributionClassReader{Client: client},
+		Logger:                  logger.WithName("ctrl"),
+		CertificateResolver:     resolver.CertificateResolver{Client: client},
+		SigningKeyResolver:      resolver.SigningKeyResolver{Client: client},
+		TargetResolver:          resolver.TargetResolver{Client: client},
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                recorder,
+		Backoff:                 newErrorBackoff(),
+		DryRun:                  opts.DryRun,
+		Providers: []provider.CDNProvider{
+			cloudfront,
+		},
+	}, nil
 }
 
 // Main function called when a reconciliation is required
@@ -109,11 +186,23 @@ func (r *DistributionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	r.log = r.Logger.WithValues("distribution", req.Namespace+"/"+req.Name)
 	r.log.Info("Reconcilliation")
 
+	ctx, span := tracing.Start(
+		ctx,
+		"DistributionReconciler.Reconcile",
+		tracing.AttributeDistribution.String(req.Namespace+"/"+req.Name),
+	)
+	defer span.End()
+
 	var distro api.Distribution
 	if err := r.Get(ctx, req.NamespacedName, &distro); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	span.SetAttributes(
+		tracing.AttributeClass.String(distro.Spec.DistributionClassRef.Name),
+		tracing.AttributeExternalId.String(distro.Status.ExternalId),
+	)
+
 	class, err := r.GetDistributionClassSpec(ctx, distro.Spec.DistributionClassRef, &distro)
 	if err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
@@ -133,6 +222,8 @@ func (r *DistributionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 		if allDeleted {
 			r.log.Info("Deletion Complete. Removing Fianlizer")
+			r.Recorder.Event(&distro, corev1.EventTypeNormal, "Deleted", "Deletion complete")
+			metrics.CertificateExpiryDays.DeleteLabelValues(distro.Namespace, distro.Name)
 			controllerutil.RemoveFinalizer(&distro, finalizer)
 			r.Update(ctx, &distro)
 		}
@@ -151,49 +242,202 @@ func (r *DistributionReconciler) reconcileProviders(
 	distro api.Distribution,
 ) ctrl.Result {
 	var err error
+	generation := distro.Generation
+	newStatus := distro.Status.DeepCopy()
+	newStatus.Ready = false
+
 	var cert *resolver.Certificate
 	if tls := distro.Spec.TLS; tls != nil {
 		r.log.V(1).Info("Distro has TLS. Running CertificateResolver")
-		cert, err = r.CertificateResolver.Resolve(client.ObjectKey{
+		cert, err = r.CertificateResolver.ResolveTLS(ctx, distro.Namespace, *tls)
+		if err != nil {
+			r.log.Error(err, "Unable to load certificate")
+			r.Recorder.Event(&distro, corev1.EventTypeWarning, "CertificateError", err.Error())
+			setCondition(newStatus, generation, api.ConditionCertificateReady, false, "CertificateError", err.Error())
+			setReadyCondition(newStatus, generation)
+			r.updateStatus(ctx, *newStatus, distro)
+			return ctrl.Result{}
+		}
+		setCondition(newStatus, generation, api.ConditionCertificateReady, true, "CertificateLoaded", "")
+		if parsed := cert.Certificate.Parsed; parsed != nil {
+			metrics.CertificateExpiryDays.
+				WithLabelValues(distro.Namespace, distro.Name).
+				Set(time.Until(parsed.NotAfter).Hours() / 24)
+		}
+	} else {
+		setCondition(newStatus, generation, api.ConditionCertificateReady, true, "NoTLS", "")
+	}
+
+	// The target's address is looked up each time, rather than being
+	// saved in the spec, so that changes to it are always picked up
+	if origin := &distro.Spec.Origin; origin.Host == "" && origin.S3 == nil && origin.TargetRef != nil {
+		origin.Host, err = r.TargetResolver.Resolve(ctx, distro.Namespace, *origin.TargetRef)
+		if err != nil {
+			r.log.Error(err, "Unable to resolve origin target")
+			r.Recorder.Event(&distro, corev1.EventTypeWarning, "TargetError", err.Error())
+			setCondition(newStatus, generation, api.ConditionOriginResolved, false, "TargetError", err.Error())
+			setReadyCondition(newStatus, generation)
+			r.updateStatus(ctx, *newStatus, distro)
+			return ctrl.Result{}
+		}
+	}
+
+	if origin := distro.Spec.Origin; origin.Host == "" && origin.S3 == nil && origin.TargetRef != nil {
+		r.log.Info("Distro's origin target has no address yet")
+		setCondition(newStatus, generation, api.ConditionOriginResolved, false, "TargetHasNoAddress", fmt.Sprintf(
+			"%v %v does not have a load balancer address yet", origin.TargetRef.Kind, origin.TargetRef.Name,
+		))
+		setReadyCondition(newStatus, generation)
+		r.updateStatus(ctx, *newStatus, distro)
+		return ctrl.Result{}
+	} else if origin.Host == "" && origin.S3 == nil {
+		r.log.Info("Distro has no origin host")
+		setCondition(newStatus, generation, api.ConditionOriginResolved, false, "NoOriginHost", "The origin has no host, and no S3 bucket")
+		setReadyCondition(newStatus, generation)
+		r.updateStatus(ctx, *newStatus, distro)
+		return ctrl.Result{}
+	}
+	setCondition(newStatus, generation, api.ConditionOriginResolved, true, "OriginResolved", "")
+
+	var key *resolver.SigningKey
+	if signed := distro.Spec.SignedURLs; signed != nil {
+		r.log.V(1).Info("Distro requires signed URLs. Running SigningKeyResolver")
+		key, err = r.SigningKeyResolver.Resolve(ctx, client.ObjectKey{
 			Namespace: distro.Namespace,
-			Name:      tls.SecretRef,
+			Name:      signed.SecretRef,
 		})
 		if err != nil {
-			r.log.Error(err, "Unable to load certificate")
-			r.updateStatus(ctx, api.DistributionStatus{Ready: false}, distro)
+			r.log.Error(err, "Unable to load signing key")
+			r.Recorder.Event(&distro, corev1.EventTypeWarning, "SigningKeyError", err.Error())
+			setCondition(newStatus, generation, api.ConditionProviderSynced, false, "SigningKeyError", err.Error())
+			setReadyCondition(newStatus, generation)
+			r.updateStatus(ctx, *newStatus, distro)
 			return ctrl.Result{}
 		}
 	}
 
-	newStatus := distro.Status.DeepCopy()
 	newStatus.Ready = true
 
 	var result ctrl.Result
 
+	held := holdReason(r.DryRun, distro)
+
 	for _, provider := range r.Providers {
 		if provider.Wants(class) {
-			err := provider.Reconcile(class, distro, cert, newStatus)
+			if held != "" {
+				err = provider.Plan(ctx, class, distro, cert, key, newStatus)
+			} else {
+				err = provider.Reconcile(ctx, class, distro, cert, key, newStatus)
+			}
 
 			if err != nil {
-				// In the event of an error we'll requeue immediately
-				result.Requeue = true
+				// In the event of an error we'll retry, backing off
+				// depending on the kind of error
+				r.Backoff.retry(&result, client.ObjectKeyFromObject(&distro), err)
 				newStatus.Ready = false
 				r.log.Error(err, "Unable to run provider")
+				r.Recorder.Event(&distro, corev1.EventTypeWarning, "ProviderError", err.Error())
+				setCondition(newStatus, generation, api.ConditionProviderSynced, false, "ProviderError", err.Error())
+			} else if held != "" {
+				r.Backoff.reset(client.ObjectKeyFromObject(&distro))
+				setHeldConditions(newStatus, distro, held)
+			} else {
+				r.Backoff.reset(client.ObjectKeyFromObject(&distro))
+				setCondition(newStatus, generation, api.ConditionProviderSynced, true, "Synced", "")
+				setDeployedCondition(newStatus, generation)
+				setMaintenanceWindowCondition(newStatus, generation)
 			}
 
 			break
 		}
 	}
 
+	setReadyCondition(newStatus, generation)
+
+	wasDeployed := meta.IsStatusConditionTrue(distro.Status.Conditions, api.ConditionDeployed)
+	if !wasDeployed && meta.IsStatusConditionTrue(newStatus.Conditions, api.ConditionDeployed) {
+		r.Recorder.Event(&distro, corev1.EventTypeNormal, "Deployed", "Deployment completed")
+
+		// Only the first deployment counts towards the time to deploy
+		if meta.FindStatusCondition(distro.Status.Conditions, api.ConditionDeployed) == nil {
+			metrics.TimeToDeployed.
+				WithLabelValues(distro.Spec.DistributionClassRef.Name).
+				Observe(time.Since(distro.CreationTimestamp.Time).Seconds())
+		}
+	}
+
 	// If there hasn't been an error requiring immediate requeue, but we
 	// aren't ready yet, we'll requeue in a minute
-	r.requeueIfNotReady(&result, newStatus.Ready)
+	r.requeueIfNotReady(&result, newStatus.Ready, reconcilePollInterval(newStatus))
 
 	r.updateStatus(ctx, *newStatus, distro)
 
+	if held != "" {
+		return result
+	}
+
+	if err := r.publishSigningKeyId(ctx, distro, newStatus.SigningKeyId); err != nil {
+		r.log.Error(err, "Unable to publish signing key id")
+		result.Requeue = true
+	}
+
+	if err := r.clearPromotion(ctx, distro, newStatus.Rollout); err != nil {
+		r.log.Error(err, "Unable to remove promote annotation")
+		result.Requeue = true
+	}
+
 	return result
 }
 
+// Removes the promote annotation once there is no longer a rollout in
+// progress, so that it does not also promote the next one
+func (r *DistributionReconciler) clearPromotion(
+	ctx context.Context,
+	distro api.Distribution,
+	rollout *api.RolloutStatus,
+) error {
+	if _, ok := distro.Annotations[api.AnnotationPromote]; !ok || rollout != nil {
+		return nil
+	}
+
+	patch := client.MergeFrom(distro.DeepCopy())
+	delete(distro.Annotations, api.AnnotationPromote)
+
+	return r.Patch(ctx, &distro, patch)
+}
+
+// Publishes the current signing key's id into a ConfigMap, so that it
+// can be used by applications which sign URLs
+//
+// The ConfigMap is owned by the Distribution, so it is garbage
+// collected when the Distribution is deleted.
+func (r *DistributionReconciler) publishSigningKeyId(
+	ctx context.Context,
+	distro api.Distribution,
+	id string,
+) error {
+	signed := distro.Spec.SignedURLs
+	if signed == nil || id == "" {
+		return nil
+	}
+
+	name := signed.ConfigMapName
+	if name == "" {
+		name = distro.Name + "-signing"
+	}
+
+	configMap := corev1.ConfigMap{}
+	configMap.SetName(name)
+	configMap.SetNamespace(distro.Namespace)
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, &configMap, func() error {
+		configMap.Data = map[string]string{"keyPairId": id}
+		return controllerutil.SetControllerReference(&distro, &configMap, r.Scheme)
+	})
+
+	return err
+}
+
 // Loops over the controllers and asks each one to delete
 func (r *DistributionReconciler) deleteProviders(
 	ctx context.Context,
@@ -207,27 +451,112 @@ func (r *DistributionReconciler) deleteProviders(
 	newStatus.Ready = false
 	allDeleted := true
 
+	policy := deletionPolicy(class, distro)
+
+	// In plan-only mode, or whilst paused, the Distribution is held on to
+	// (by its finalizer) with a plan explaining what would have happened,
+	// whatever its deletion policy
+	if held := holdReason(r.DryRun, distro); held != "" {
+		r.log.Info("Not deleting external resources", "reason", held, "policy", policy)
+		newStatus.Plan = []string{deletionPlans[policy]}
+		setDeletingCondition(newStatus, distro.Generation, held, "Deletion planned but not applied")
+		r.updateStatus(ctx, *newStatus, distro)
+		return false, result
+	}
+
+	switch policy {
+	case api.DeletionPolicyRetain:
+		r.log.Info("Deletion policy is Retain. Leaving external resources in place")
+		r.Recorder.Event(&distro, corev1.EventTypeNormal, "Retained", "External resources have been left in place")
+		return true, result
+	case api.DeletionPolicyDisable:
+		r.log.Info("Deletion policy is Disable. Disabling external distribution")
+		return r.disableProviders(ctx, class, distro)
+	}
+
 	for _, provider := range r.Providers {
 		if !provider.Wants(class) {
 			continue
 		}
 
-		err := provider.Delete(class, distro, newStatus)
+		err := provider.Delete(ctx, class, distro, newStatus)
 
 		if err != nil {
-			result.Requeue = true
+			r.Backoff.retry(&result, client.ObjectKeyFromObject(&distro), err)
 			log.Info("Error", "error", err)
+			r.Recorder.Event(&distro, corev1.EventTypeWarning, "ProviderError", err.Error())
+			setDeletingCondition(newStatus, distro.Generation, "ProviderError", err.Error())
+		} else {
+			r.Backoff.reset(client.ObjectKeyFromObject(&distro))
+			setDeletingCondition(newStatus, distro.Generation, "Deleting", "Waiting for external resources to be removed")
 		}
 
-		allDeleted = newStatus.ExternalId == "" && newStatus.ExternalCertificateId == ""
+		allDeleted = newStatus.ExternalId == "" &&
+			newStatus.ExternalCertificateId == "" &&
+			newStatus.Providers == (api.ProviderStatusList{})
 	}
 
-	r.requeueIfNotReady(&result, allDeleted)
+	r.requeueIfNotReady(&result, allDeleted, deletePollInterval(newStatus))
 	r.updateStatus(ctx, *newStatus, distro)
 
 	return allDeleted, result
 }
 
+// Loops over the providers and asks each one to disable its
+// distribution
+//
+// Once this has succeeded, there is nothing more for the controller to
+// track, so the Distribution can be removed.
+func (r *DistributionReconciler) disableProviders(
+	ctx context.Context,
+	class api.DistributionClassSpec,
+	distro api.Distribution,
+) (bool, ctrl.Result) {
+	var result ctrl.Result
+	newStatus := distro.Status.DeepCopy()
+	newStatus.Ready = false
+
+	for _, provider := range r.Providers {
+		if !provider.Wants(class) {
+			continue
+		}
+
+		if err := provider.Disable(ctx, class, distro, newStatus); err != nil {
+			r.log.Error(err, "Unable to disable distribution")
+			r.Recorder.Event(&distro, corev1.EventTypeWarning, "ProviderError", err.Error())
+			r.Backoff.retry(&result, client.ObjectKeyFromObject(&distro), err)
+			setDeletingCondition(newStatus, distro.Generation, "ProviderError", err.Error())
+			r.updateStatus(ctx, *newStatus, distro)
+			return false, result
+		}
+	}
+
+	return true, result
+}
+
+// What is planned for the external resources under each deletion
+// policy, whilst a deleted Distribution is held
+var deletionPlans = map[api.DeletionPolicy]string{
+	api.DeletionPolicyDelete:  "Delete external resources",
+	api.DeletionPolicyRetain:  "Leave external resources in place",
+	api.DeletionPolicyDisable: "Disable external distribution",
+}
+
+// Returns the deletion policy for the Distribution, falling back to its
+// class's default
+func deletionPolicy(
+	class api.DistributionClassSpec,
+	distro api.Distribution,
+) api.DeletionPolicy {
+	if policy := distro.Spec.DeletionPolicy; policy != "" {
+		return policy
+	} else if policy := class.DeletionPolicy; policy != "" {
+		return policy
+	}
+
+	return api.DeletionPolicyDelete
+}
+
 // Checks to see if the status has been updated during the
 // reconciliation and updates it with the api-server if it has done
 func (r *DistributionReconciler) updateStatus(
@@ -235,6 +564,7 @@ func (r *DistributionReconciler) updateStatus(
 	newStatus api.DistributionStatus,
 	distro api.Distribution,
 ) {
+	newStatus.ObservedGeneration = distro.Generation
 	if !reflect.DeepEqual(newStatus, distro.Status) {
 		r.log.V(1).Info("Status change detected. Updating with api-server")
 		distro.Status = newStatus
@@ -242,20 +572,23 @@ func (r *DistributionReconciler) updateStatus(
 	}
 }
 
-// Checks to see if the given condition is not met and adds a requeue in
-// one minute request to the given result
+// Checks to see if the given condition is not met and adds a requeue
+// after the given interval to the given result
 //
 // The "condition" depends on the caller - for the reconciliation code,
 // this is normally "Status.Ready", for the deletion code, this is if
 // all resources have been deleted.
 //
-// NB: This method checks to see if the Requeue flag has already been
-// set on the result. If it has, it does not add a 1m RequeueAfter as
-// the Requeue flag is assumed to mean "requeue immediately" (this is
-// normally set in the event of failure).
-func (r *DistributionReconciler) requeueIfNotReady(result *ctrl.Result, condition bool) {
-	if !result.Requeue && !condition {
-		r.log.Info("Resource is not in desired state. Scheduling recheck in 1m")
-		result.RequeueAfter, _ = time.ParseDuration("1m")
+// NB: This method checks to see if a requeue has already been set on
+// the result. If it has, it is left alone, as this is assumed to be a
+// retry after a failure.
+func (r *DistributionReconciler) requeueIfNotReady(
+	result *ctrl.Result,
+	condition bool,
+	interval time.Duration,
+) {
+	if !result.Requeue && result.RequeueAfter == 0 && !condition {
+		r.log.Info("Resource is not in desired state. Scheduling recheck", "after", interval)
+		result.RequeueAfter = interval
 	}
 }
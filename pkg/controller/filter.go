@@ -0,0 +1,78 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Limits which Ingresses, Services, HTTPRoutes, Routes and
+// VirtualServices are considered when creating Distributions. Resources
+// which don't match are ignored, even if they have the distribution
+// class annotations.
+type SourceFilter struct {
+	// If given, only resources in these namespaces are considered
+	Namespaces []string
+
+	// If given, only resources with matching labels are considered
+	Selector labels.Selector
+}
+
+// Checks if the resource matches the filter
+func (f SourceFilter) Matches(obj client.Object) bool {
+	if len(f.Namespaces) > 0 && !contains(f.Namespaces, obj.GetNamespace()) {
+		return false
+	}
+
+	return f.Selector == nil || f.Selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// Returns a predicate which drops events for resources which don't
+// match the filter
+//
+// Updates are let through if either the old or new version matches, so
+// that a resource which is moved out of the filter (eg by changing its
+// labels) is reconciled, and its Distributions are removed.
+func (f SourceFilter) predicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return f.Matches(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return f.Matches(e.ObjectOld) || f.Matches(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return f.Matches(e.Object)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return f.Matches(e.Object)
+		},
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
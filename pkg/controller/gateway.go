@@ -0,0 +1,399 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
+)
+
+// +kubebuilder:rbac:groups=cdn.redcoat.dev,resources=distributions,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways;httproutes,verbs=get;list;watch
+
+// The Gateway API types are used via unstructured objects, so that the
+// controller does not depend on a particular release of the Gateway API
+var (
+	gatewayGVK   = resolver.GatewayGVK
+	httpRouteGVK = gatewayGVK.GroupVersion().WithKind("HTTPRoute")
+)
+
+// The index of HTTPRoutes by the "<namespace>/<name>" of their parent
+// Gateways
+const routeGatewayIndex = "gateway"
+
+type HTTPRouteReconciler struct {
+	client.Client
+
+	// The current scheme we are working with
+	Scheme *runtime.Scheme
+
+	// Limits which resources are considered
+	Filter SourceFilter
+
+	// Used to record events against HTTPRoutes
+	Recorder record.EventRecorder
+}
+
+// A Gateway which an HTTPRoute is attached to
+type routeParent struct {
+	Gateway *unstructured.Unstructured
+
+	// The listener the route is attached to, if it names one
+	SectionName string
+}
+
+// Checks if the Gateway API's CRDs are installed in the cluster
+func GatewayAPIInstalled(mgr ctrl.Manager) bool {
+	return installed(mgr, httpRouteGVK)
+}
+
+// Creates a new HTTPRouteController
+func NewHTTPRouteController(mgr ctrl.Manager, filter SourceFilter) error {
+	err := mgr.GetFieldIndexer().IndexField(
+		context.TODO(),
+		newUnstructured(httpRouteGVK),
+		routeGatewayIndex,
+		func(obj client.Object) []string {
+			var gateways []string
+			for _, ref := range gatewayRefs(obj.(*unstructured.Unstructured)) {
+				gateways = append(gateways, ref.Namespace+"/"+ref.Name)
+			}
+			return gateways
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	r := &HTTPRouteReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Filter:   filter,
+		Recorder: mgr.GetEventRecorderFor("cdn-manager"),
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(newUnstructured(httpRouteGVK), builder.WithPredicates(filter.predicate())).
+		Owns(&api.Distribution{}).
+		Watches(
+			&source.Kind{Type: resolver.NewGateway()},
+			handler.EnqueueRequestsFromMapFunc(r.routesForGateway),
+		).
+		Complete(r)
+}
+
+// The main reconciliation loop
+func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	log.V(1).Info("HTTPRoute Reconciliation")
+
+	route := newUnstructured(httpRouteGVK)
+	if err := r.Get(ctx, req.NamespacedName, route); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !r.Filter.Matches(route) {
+		log.V(1).Info("HTTPRoute is outside of the watched namespaces or selector. Removing any Distributions it owns")
+		return ctrl.Result{}, removeStaleDistributions(ctx, r.Client, r.Recorder, route, nil)
+	}
+
+	parents := r.getParents(ctx, route)
+
+	// The class can be given on the route itself, or on its Gateway to
+	// apply to all of the Gateway's routes
+	class := resolver.GetDistributionClass(route)
+	for i := 0; class == nil && i < len(parents); i++ {
+		class = resolver.GetDistributionClass(parents[i].Gateway)
+	}
+
+	if class == nil {
+		log.V(1).Info("HTTPRoute has no annotations. Removing any Distributions it owns")
+		return ctrl.Result{}, removeStaleDistributions(ctx, r.Client, r.Recorder, route, nil)
+	}
+
+	log = log.WithValues("class", class)
+	log.Info("Starting Reconciliation")
+
+	overrides, errs := resolver.ParseIngressOverrides(route)
+	for _, err := range errs {
+		log.V(-1).Info(err.Error())
+		r.Recorder.Event(route, corev1.EventTypeWarning, "InvalidAnnotation", err.Error())
+	}
+
+	desired, warnings := r.getDesiredDistribution(route, parents, *class, &overrides)
+	if desired.Spec.Origin.Host == "" {
+		log.V(-1).Info("Unable to determine origin for HTTPRoute. Skipping")
+		return ctrl.Result{}, nil
+	}
+
+	for _, warning := range warnings {
+		log.V(-1).Info(warning)
+		r.Recorder.Event(route, corev1.EventTypeWarning, "HostNotCovered", warning)
+	}
+
+	syncDistribution(ctx, r.Client, r.Recorder, route, &desired)
+
+	return ctrl.Result{}, removeStaleDistributions(
+		ctx, r.Client, r.Recorder, route, []api.Distribution{desired},
+	)
+}
+
+// Returns a Distribution with the desired Spec for this HTTPRoute, along
+// with warnings about any hosts which cannot be served
+//
+// The origin is taken from the first parent Gateway with an address. If
+// one of the Gateway's HTTPS listeners accepts all of the route's
+// hostnames, its certificate is used for the Distribution.
+func (r *HTTPRouteReconciler) getDesiredDistribution(
+	route *unstructured.Unstructured,
+	parents []routeParent,
+	class api.ObjectReference,
+	overrides *resolver.IngressOverrides,
+) (api.Distribution, []string) {
+	desired := resolver.DistributionFromIngress(class, nil)
+	resolver.AddDistributionMeta(route, &desired)
+
+	var parent *routeParent
+	for i := range parents {
+		if host := resolver.GetGatewayHost(parents[i].Gateway); host != "" {
+			parent = &parents[i]
+			desired.Spec.Origin.Host = host
+			break
+		}
+	}
+
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	if overrides.Hosts != nil {
+		hostnames = overrides.Hosts
+	}
+
+	var hosts []string
+	for _, host := range hostnames {
+		if overrides.Includes(host) {
+			hosts = append(hosts, host)
+		}
+	}
+	desired.Spec.Hosts = hosts
+
+	var warnings []string
+	if parent != nil {
+		listener, warning := findHTTPSListener(parent, route.GetNamespace(), hosts)
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+
+		if listener != nil {
+			desired.Spec.TLS = &api.TLSSpec{
+				SecretRef: listener.SecretName,
+				Mode:      "redirect",
+			}
+			desired.Spec.Origin.HTTPSPort = listener.Port
+		}
+		if port := listenerPort(parent.Gateway, "HTTP"); port != 0 {
+			desired.Spec.Origin.HTTPPort = port
+		}
+	}
+
+	overrides.Apply(&desired)
+
+	return desired, warnings
+}
+
+// Fetches the Gateways which the HTTPRoute is attached to. Any which do
+// not exist are skipped.
+func (r *HTTPRouteReconciler) getParents(
+	ctx context.Context,
+	route *unstructured.Unstructured,
+) []routeParent {
+	var parents []routeParent
+	for _, ref := range gatewayRefs(route) {
+		gateway := resolver.NewGateway()
+		key := client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+		if err := r.Get(ctx, key, gateway); err != nil {
+			continue
+		}
+
+		parents = append(parents, routeParent{
+			Gateway:     gateway,
+			SectionName: ref.SectionName,
+		})
+	}
+
+	return parents
+}
+
+// Returns requests for all of the HTTPRoutes attached to the Gateway
+func (r *HTTPRouteReconciler) routesForGateway(gateway client.Object) []ctrl.Request {
+	routes := &unstructured.UnstructuredList{}
+	routes.SetGroupVersionKind(httpRouteGVK.GroupVersion().WithKind("HTTPRouteList"))
+
+	key := gateway.GetNamespace() + "/" + gateway.GetName()
+	if err := r.List(context.TODO(), routes, client.MatchingFields{routeGatewayIndex: key}); err != nil {
+		return nil
+	}
+
+	requests := make([]ctrl.Request, len(routes.Items))
+	for i := range routes.Items {
+		requests[i] = ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&routes.Items[i])}
+	}
+
+	return requests
+}
+
+// A reference from an HTTPRoute to a Gateway
+type gatewayRef struct {
+	Namespace   string
+	Name        string
+	SectionName string
+}
+
+// Returns the HTTPRoute's parentRefs which refer to Gateways, with their
+// defaults filled in
+func gatewayRefs(route *unstructured.Unstructured) []gatewayRef {
+	parentRefs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+
+	var refs []gatewayRef
+	for _, item := range parentRefs {
+		parentRef, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		group := stringField(parentRef, "group", gatewayGVK.Group)
+		kind := stringField(parentRef, "kind", gatewayGVK.Kind)
+		if group != gatewayGVK.Group || kind != gatewayGVK.Kind {
+			continue
+		}
+
+		refs = append(refs, gatewayRef{
+			Namespace:   stringField(parentRef, "namespace", route.GetNamespace()),
+			Name:        stringField(parentRef, "name", ""),
+			SectionName: stringField(parentRef, "sectionName", ""),
+		})
+	}
+
+	return refs
+}
+
+// An HTTPS listener on a Gateway, whose certificate can be used by a
+// Distribution
+type httpsListener struct {
+	Port       int32
+	SecretName string
+}
+
+// Finds the HTTPS listener which accepts all of the hosts
+//
+// Its certificate must be a Secret in the route's namespace, as
+// Distributions can only use certificates in their own namespace. If
+// there isn't a suitable listener, the hosts are served over plain HTTP
+// and a warning explaining why is returned.
+func findHTTPSListener(
+	parent *routeParent,
+	namespace string,
+	hosts []string,
+) (*httpsListener, string) {
+	listeners, _, _ := unstructured.NestedSlice(parent.Gateway.Object, "spec", "listeners")
+	gatewayNamespace := parent.Gateway.GetNamespace()
+
+	for _, item := range listeners {
+		listener, ok := item.(map[string]interface{})
+		if !ok || stringField(listener, "protocol", "") != "HTTPS" {
+			continue
+		}
+		if parent.SectionName != "" && stringField(listener, "name", "") != parent.SectionName {
+			continue
+		}
+		if hostname := stringField(listener, "hostname", ""); hostname != "" {
+			if !coversAll(hostname, hosts) {
+				continue
+			}
+		}
+
+		refs, _, _ := unstructured.NestedSlice(listener, "tls", "certificateRefs")
+		if len(refs) == 0 {
+			continue
+		}
+		ref, ok := refs[0].(map[string]interface{})
+		if !ok || stringField(ref, "kind", "Secret") != "Secret" || stringField(ref, "group", "") != "" {
+			continue
+		}
+
+		if secretNamespace := stringField(ref, "namespace", gatewayNamespace); secretNamespace != namespace {
+			return nil, fmt.Sprintf(
+				"The certificate for listener %v is in namespace %v, not %v, so hosts will be served over plain HTTP",
+				stringField(listener, "name", ""),
+				secretNamespace,
+				namespace,
+			)
+		}
+
+		port, _, _ := unstructured.NestedInt64(listener, "port")
+		return &httpsListener{
+			Port:       int32(port),
+			SecretName: stringField(ref, "name", ""),
+		}, ""
+	}
+
+	if len(hosts) == 0 {
+		return nil, ""
+	}
+
+	return nil, fmt.Sprintf(
+		"Gateway %v has no HTTPS listener for all of the route's hostnames, so they will be served over plain HTTP",
+		parent.Gateway.GetName(),
+	)
+}
+
+// Returns the port of the Gateway's first listener with the protocol, or
+// 0 if it does not have one
+func listenerPort(gateway *unstructured.Unstructured, protocol string) int32 {
+	listeners, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	for _, item := range listeners {
+		listener, ok := item.(map[string]interface{})
+		if ok && stringField(listener, "protocol", "") == protocol {
+			port, _, _ := unstructured.NestedInt64(listener, "port")
+			return int32(port)
+		}
+	}
+
+	return 0
+}
+
+// Checks if a listener's hostname accepts every one of the hosts
+func coversAll(hostname string, hosts []string) bool {
+	for _, host := range hosts {
+		if !resolver.CoversHost([]string{hostname}, host) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -18,12 +18,13 @@ package controller
 
 import (
 	"context"
-	"reflect"
 
 	corev1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
@@ -31,8 +32,13 @@ import (
 	"gitlab.com/redcoat/cdn-manager/pkg/util"
 )
 
-// +kubebuilder:rbac:groups=cdn.redcoat.dev,resources=distributions,verbs=get;list;watch;create;update
-// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;watch;list
+// +kubebuilder:rbac:groups=cdn.redcoat.dev,resources=distributions,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;watch;list;patch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=patch
+
+// The deprecated annotation used to set an Ingress' class, before
+// spec.ingressClassName was added
+const annotationIngressClass = "kubernetes.io/ingress.class"
 
 type IngressReconciler struct {
 	client.Client
@@ -40,18 +46,61 @@ type IngressReconciler struct {
 	// The current scheme we are working with
 	Scheme *runtime.Scheme
 
+	// The Service of the ingress controller, used for Ingresses whose
+	// class is not in IngressClassServices. If this is not set, the
+	// Ingress' own status is used instead.
 	IngressService *client.ObjectKey
+
+	// The Services of the ingress controllers for each IngressClass
+	IngressClassServices map[string]client.ObjectKey
+
+	// Limits which Ingresses are considered
+	Filter SourceFilter
+
+	// If set, the endpoints and readiness of the Ingress' Distributions
+	// are published as annotations on the Ingress
+	PublishEndpoints bool
+
+	// If set, the Ingress' load balancer status is rewritten to point at
+	// its Distributions, once they are ready
+	PublishStatus bool
+
+	// Used to record events against Ingresses
+	Recorder record.EventRecorder
+}
+
+// Options for the IngressController, normally set from the command line
+type IngressOptions struct {
+	// See IngressReconciler.IngressService, in the form namespace/name
+	Service string
+
+	// See IngressReconciler.IngressClassServices
+	ClassServices map[string]client.ObjectKey
+
+	// See IngressReconciler.Filter
+	Filter SourceFilter
+
+	// See IngressReconciler.PublishEndpoints
+	PublishEndpoints bool
+
+	// See IngressReconciler.PublishStatus
+	PublishStatus bool
 }
 
 // Creates a new IngressController
-func NewIngressController(mgr ctrl.Manager, ingressService string) error {
+func NewIngressController(mgr ctrl.Manager, opts IngressOptions) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&networking.Ingress{}).
+		For(&networking.Ingress{}, builder.WithPredicates(opts.Filter.predicate())).
 		Owns(&api.Distribution{}).
 		Complete(&IngressReconciler{
-			Client:         mgr.GetClient(),
-			Scheme:         mgr.GetScheme(),
-			IngressService: util.ObjectKeyFromString(ingressService),
+			Client:               mgr.GetClient(),
+			Scheme:               mgr.GetScheme(),
+			IngressService:       util.ObjectKeyFromString(opts.Service),
+			IngressClassServices: opts.ClassServices,
+			Filter:               opts.Filter,
+			PublishEndpoints:     opts.PublishEndpoints,
+			PublishStatus:        opts.PublishStatus,
+			Recorder:             mgr.GetEventRecorderFor("cdn-manager"),
 		})
 }
 
@@ -61,77 +110,101 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	log.V(1).Info("Ingress Reconciliation")
 
 	var ingress networking.Ingress
-	r.Get(ctx, req.NamespacedName, &ingress)
+	if err := r.Get(ctx, req.NamespacedName, &ingress); err != nil {
+		// Any Distributions owned by a deleted Ingress are garbage
+		// collected
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
 
 	class := resolver.GetDistributionClass(&ingress)
 
-	if class == nil {
-		log.V(1).Info("Ignoring ingress without annotations")
-		return ctrl.Result{}, nil
+	if !r.Filter.Matches(&ingress) || class == nil {
+		log.V(1).Info("Ingress has no annotations, or is outside of the watched namespaces or selector. Removing any Distributions it owns")
+		if err := removeStaleDistributions(ctx, r.Client, r.Recorder, &ingress, nil); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.unpublishEndpoints(ctx, &ingress)
 	}
 
 	log = log.WithValues("class", class)
 	log.Info("Starting Reconciliation")
 
-	var distro api.Distribution
-	err := r.Get(ctx, req.NamespacedName, &distro)
+	overrides, errs := resolver.ParseIngressOverrides(&ingress)
+	for _, err := range errs {
+		log.V(-1).Info(err.Error())
+		r.Recorder.Event(&ingress, corev1.EventTypeWarning, "InvalidAnnotation", err.Error())
+	}
 
-	desired := r.getDesiredDistribution(ingress, *class)
-	if desired.Spec.Origin.Host == "" {
+	desired, warnings := r.getDesiredDistributions(ingress, *class, &overrides)
+	if desired[0].Spec.Origin.Host == "" {
 		log.V(-1).Info("Unable to determine origin for ingress. Skipping")
 		return ctrl.Result{}, nil
 	}
 
-	if err != nil {
-		resolver.AddDistributionMeta(&ingress, &desired)
+	for _, warning := range warnings {
+		log.V(-1).Info(warning)
+		r.Recorder.Event(&ingress, corev1.EventTypeWarning, "HostNotCovered", warning)
+	}
 
-		err := r.Create(ctx, &desired)
-		if err != nil {
-			log.V(-3).Error(err, "Couldn't create distribution")
-		}
-	} else {
-		if !reflect.DeepEqual(desired.Spec, distro.Spec) {
-			log.V(1).Info("Distribution is out of sync!")
+	for i := range desired {
+		syncDistribution(ctx, r.Client, r.Recorder, &ingress, &desired[i])
+	}
 
-			distro.Spec = desired.Spec
-			err := r.Update(ctx, &distro)
-			if err != nil {
-				log.V(-3).Error(err, "Couldn't update distribution")
-			}
-		}
+	if err := removeStaleDistributions(ctx, r.Client, r.Recorder, &ingress, desired); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{}, r.publishEndpoints(ctx, &ingress, desired)
 }
 
-// Returns a Distribution with the desired Spec for this Ingress
-func (r *IngressReconciler) getDesiredDistribution(
+// Returns the Distributions, with their desired Specs, for this Ingress,
+// along with warnings about any hosts which cannot be served
+func (r *IngressReconciler) getDesiredDistributions(
 	ingress networking.Ingress,
 	class api.ObjectReference,
-) api.Distribution {
+	overrides *resolver.IngressOverrides,
+) ([]api.Distribution, []string) {
 	var ingressLB []corev1.LoadBalancerIngress
-	if r.IngressService == nil {
+	if service := r.getIngressService(&ingress); service == nil {
 		ingressLB = ingress.Status.LoadBalancer.Ingress
 	} else {
 		var svc corev1.Service
-		r.Get(context.TODO(), *r.IngressService, &svc)
+		r.Get(context.TODO(), *service, &svc)
 		ingressLB = svc.Status.LoadBalancer.Ingress
 	}
 
-	desired := resolver.DistributionFromIngress(class, ingressLB)
-
-	// Currently only one TLS certificate is supported and hosts are only
-	// added if TLS is enabled.
-	// TODO: Add hosts from ingress rules so TLS is not required
-	// TODO: Decide how to handle multiple IngressTLS entries
-	if len(ingress.Spec.TLS) > 0 {
-		desired.Spec.Hosts = ingress.Spec.TLS[0].Hosts
-		desired.Spec.TLS = &api.TLSSpec{
-			SecretRef: ingress.Spec.TLS[0].SecretName,
-			// A sensible default for the moment
-			Mode: "redirect",
+	groups, warnings := resolver.GroupIngressHosts(&ingress, overrides)
+	desired := make([]api.Distribution, len(groups))
+	for i, group := range groups {
+		desired[i] = resolver.DistributionFromIngress(class, ingressLB)
+		resolver.AddDistributionMeta(&ingress, &desired[i])
+		desired[i].Name += group.Suffix
+		desired[i].Spec.Hosts = group.Hosts
+
+		if group.SecretName != "" {
+			desired[i].Spec.TLS = &api.TLSSpec{
+				SecretRef: group.SecretName,
+				Mode:      "redirect",
+			}
 		}
+
+		overrides.Apply(&desired[i])
+	}
+
+	return desired, warnings
+}
+
+// Returns the Service of the ingress controller handling the Ingress,
+// based on its IngressClass. If this is not known, nil is returned.
+func (r *IngressReconciler) getIngressService(ingress *networking.Ingress) *client.ObjectKey {
+	className := ingress.Annotations[annotationIngressClass]
+	if name := ingress.Spec.IngressClassName; name != nil {
+		className = *name
+	}
+
+	if service, ok := r.IngressClassServices[className]; ok && className != "" {
+		return &service
 	}
 
-	return desired
+	return r.IngressService
 }
@@ -0,0 +1,411 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
+)
+
+// +kubebuilder:rbac:groups=cdn.redcoat.dev,resources=distributions,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=networking.istio.io,resources=gateways;virtualservices,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;watch;list
+
+// Istio's types are used via unstructured objects, so that the
+// controller does not depend on Istio's API packages
+var (
+	istioGatewayGVK = schema.GroupVersionKind{
+		Group:   "networking.istio.io",
+		Version: "v1beta1",
+		Kind:    "Gateway",
+	}
+	virtualServiceGVK = istioGatewayGVK.GroupVersion().WithKind("VirtualService")
+)
+
+// The index of VirtualServices by the "<namespace>/<name>" of their
+// Gateways
+const virtualServiceGatewayIndex = "istioGateway"
+
+type VirtualServiceReconciler struct {
+	client.Client
+
+	// The current scheme we are working with
+	Scheme *runtime.Scheme
+
+	// Limits which resources are considered
+	Filter SourceFilter
+
+	// Used to record events against VirtualServices
+	Recorder record.EventRecorder
+}
+
+// Checks if Istio's CRDs are installed in the cluster
+func IstioInstalled(mgr ctrl.Manager) bool {
+	return installed(mgr, virtualServiceGVK)
+}
+
+// Creates a new VirtualServiceController
+func NewVirtualServiceController(mgr ctrl.Manager, filter SourceFilter) error {
+	err := mgr.GetFieldIndexer().IndexField(
+		context.TODO(),
+		newUnstructured(virtualServiceGVK),
+		virtualServiceGatewayIndex,
+		func(obj client.Object) []string {
+			var gateways []string
+			for _, key := range istioGatewayKeys(obj.(*unstructured.Unstructured)) {
+				gateways = append(gateways, key.String())
+			}
+			return gateways
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	r := &VirtualServiceReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Filter:   filter,
+		Recorder: mgr.GetEventRecorderFor("cdn-manager"),
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(newUnstructured(virtualServiceGVK), builder.WithPredicates(filter.predicate())).
+		Owns(&api.Distribution{}).
+		Watches(
+			&source.Kind{Type: newUnstructured(istioGatewayGVK)},
+			handler.EnqueueRequestsFromMapFunc(r.virtualServicesForGateway),
+		).
+		// The origin is the Gateway's Service's load balancer, which may
+		// change (or first be assigned) after the VirtualService
+		Watches(
+			&source.Kind{Type: &corev1.Service{}},
+			handler.EnqueueRequestsFromMapFunc(r.virtualServicesForService),
+		).
+		Complete(r)
+}
+
+// The main reconciliation loop
+func (r *VirtualServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	log.V(1).Info("VirtualService Reconciliation")
+
+	vs := newUnstructured(virtualServiceGVK)
+	if err := r.Get(ctx, req.NamespacedName, vs); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !r.Filter.Matches(vs) {
+		log.V(1).Info("VirtualService is outside of the watched namespaces or selector. Removing any Distributions it owns")
+		return ctrl.Result{}, removeStaleDistributions(ctx, r.Client, r.Recorder, vs, nil)
+	}
+
+	var gateways []*unstructured.Unstructured
+	for _, key := range istioGatewayKeys(vs) {
+		gateway := newUnstructured(istioGatewayGVK)
+		if err := r.Get(ctx, key, gateway); err == nil {
+			gateways = append(gateways, gateway)
+		}
+	}
+
+	// As with HTTPRoutes, the class can be given on the VirtualService,
+	// or on its Gateway
+	class := resolver.GetDistributionClass(vs)
+	for i := 0; class == nil && i < len(gateways); i++ {
+		class = resolver.GetDistributionClass(gateways[i])
+	}
+
+	if class == nil {
+		log.V(1).Info("VirtualService has no annotations. Removing any Distributions it owns")
+		return ctrl.Result{}, removeStaleDistributions(ctx, r.Client, r.Recorder, vs, nil)
+	}
+
+	log = log.WithValues("class", class)
+	log.Info("Starting Reconciliation")
+
+	overrides, errs := resolver.ParseIngressOverrides(vs)
+	for _, err := range errs {
+		log.V(-1).Info(err.Error())
+		r.Recorder.Event(vs, corev1.EventTypeWarning, "InvalidAnnotation", err.Error())
+	}
+
+	desired, warning, err := r.getDesiredDistribution(ctx, vs, gateways, *class, &overrides)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if desired.Spec.Origin.Host == "" {
+		log.V(-1).Info("Unable to determine origin for VirtualService. Skipping")
+		return ctrl.Result{}, nil
+	}
+
+	if warning != "" {
+		log.V(-1).Info(warning)
+		r.Recorder.Event(vs, corev1.EventTypeWarning, "HostNotCovered", warning)
+	}
+
+	syncDistribution(ctx, r.Client, r.Recorder, vs, &desired)
+
+	return ctrl.Result{}, removeStaleDistributions(
+		ctx, r.Client, r.Recorder, vs, []api.Distribution{desired},
+	)
+}
+
+// Returns a Distribution with the desired Spec for this VirtualService,
+// along with a warning if its hosts cannot be served over TLS
+//
+// Istio Gateways don't report an address, so the origin is taken from
+// the LoadBalancer Service in front of the gateway pods they select. If
+// one of the Gateway's HTTPS servers accepts all of the hosts, its
+// credential is used as the Distribution's certificate.
+func (r *VirtualServiceReconciler) getDesiredDistribution(
+	ctx context.Context,
+	vs *unstructured.Unstructured,
+	gateways []*unstructured.Unstructured,
+	class api.ObjectReference,
+	overrides *resolver.IngressOverrides,
+) (api.Distribution, string, error) {
+	desired := resolver.DistributionFromIngress(class, nil)
+	resolver.AddDistributionMeta(vs, &desired)
+
+	// VirtualServices can also list the short names of services in the
+	// mesh, which can't be used by a CDN
+	hosts := overrides.Hosts
+	if hosts == nil {
+		hosts, _, _ = unstructured.NestedStringSlice(vs.Object, "spec", "hosts")
+	}
+	for _, host := range hosts {
+		if strings.Contains(host, ".") && overrides.Includes(host) {
+			desired.Spec.Hosts = append(desired.Spec.Hosts, host)
+		}
+	}
+
+	var gateway *unstructured.Unstructured
+	var svc *corev1.Service
+	for _, candidate := range gateways {
+		var err error
+		if svc, err = r.getGatewayService(ctx, candidate); err != nil {
+			return desired, "", err
+		} else if svc != nil {
+			gateway = candidate
+			desired.Spec.Origin.Host = resolver.GetIngressHost(svc.Status.LoadBalancer.Ingress)
+			break
+		}
+	}
+
+	if gateway == nil {
+		overrides.Apply(&desired)
+		return desired, "", nil
+	}
+
+	var warning string
+	servers, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "servers")
+	for _, item := range servers {
+		server, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		port, _, _ := unstructured.NestedMap(server, "port")
+		number, _, _ := unstructured.NestedInt64(server, "port", "number")
+		protocol := stringField(port, "protocol", "")
+		if protocol == "HTTP" {
+			desired.Spec.Origin.HTTPPort = int32(number)
+			continue
+		} else if protocol != "HTTPS" || desired.Spec.TLS != nil {
+			continue
+		}
+
+		serverHosts, _, _ := unstructured.NestedStringSlice(server, "hosts")
+		if !serverCoversAll(serverHosts, desired.Spec.Hosts) {
+			continue
+		}
+
+		tls, _, _ := unstructured.NestedMap(server, "tls")
+		credential := stringField(tls, "credentialName", "")
+		if stringField(tls, "mode", "") != "SIMPLE" || credential == "" {
+			continue
+		}
+
+		// Gateway credentials live alongside the gateway pods, but
+		// Distributions can only use secrets in their own namespace
+		if svc.Namespace != vs.GetNamespace() {
+			warning = fmt.Sprintf(
+				"The credential for Gateway %v is in namespace %v, not %v, so hosts will be served over plain HTTP",
+				gateway.GetName(),
+				svc.Namespace,
+				vs.GetNamespace(),
+			)
+			continue
+		}
+
+		desired.Spec.Origin.HTTPSPort = int32(number)
+		desired.Spec.TLS = &api.TLSSpec{
+			SecretRef: credential,
+			Mode:      "redirect",
+		}
+	}
+
+	if desired.Spec.TLS != nil {
+		warning = ""
+	} else if warning == "" && len(desired.Spec.Hosts) > 0 {
+		warning = fmt.Sprintf(
+			"Gateway %v has no HTTPS server with a credential for all of the hosts, so they will be served over plain HTTP",
+			gateway.GetName(),
+		)
+	}
+
+	overrides.Apply(&desired)
+
+	return desired, warning, nil
+}
+
+// Finds the LoadBalancer Service in front of the pods selected by the
+// Gateway, or nil if there isn't one
+func (r *VirtualServiceReconciler) getGatewayService(
+	ctx context.Context,
+	gateway *unstructured.Unstructured,
+) (*corev1.Service, error) {
+	selector, _, _ := unstructured.NestedStringMap(gateway.Object, "spec", "selector")
+	if len(selector) == 0 {
+		return nil, nil
+	}
+
+	var services corev1.ServiceList
+	if err := r.List(ctx, &services); err != nil {
+		return nil, err
+	}
+
+	matches := labels.SelectorFromSet(selector)
+	for i := range services.Items {
+		svc := &services.Items[i]
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer && matches.Matches(labels.Set(svc.Spec.Selector)) {
+			return svc, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Returns requests for all of the VirtualServices using the Gateway
+func (r *VirtualServiceReconciler) virtualServicesForGateway(gateway client.Object) []ctrl.Request {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(virtualServiceGVK.GroupVersion().WithKind("VirtualServiceList"))
+
+	key := client.ObjectKeyFromObject(gateway).String()
+	if err := r.List(context.TODO(), list, client.MatchingFields{virtualServiceGatewayIndex: key}); err != nil {
+		return nil
+	}
+
+	requests := make([]ctrl.Request, len(list.Items))
+	for i := range list.Items {
+		requests[i] = ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])}
+	}
+
+	return requests
+}
+
+// Returns requests for all of the VirtualServices using a Gateway which
+// selects the same pods as the Service
+func (r *VirtualServiceReconciler) virtualServicesForService(obj client.Object) []ctrl.Request {
+	svc := obj.(*corev1.Service)
+	if len(svc.Spec.Selector) == 0 {
+		return nil
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(istioGatewayGVK.GroupVersion().WithKind("GatewayList"))
+	if err := r.List(context.TODO(), list); err != nil {
+		return nil
+	}
+
+	var requests []ctrl.Request
+	for i := range list.Items {
+		gateway := &list.Items[i]
+		selector, _, _ := unstructured.NestedStringMap(gateway.Object, "spec", "selector")
+		if len(selector) == 0 {
+			continue
+		}
+
+		if labels.SelectorFromSet(selector).Matches(labels.Set(svc.Spec.Selector)) {
+			requests = append(requests, r.virtualServicesForGateway(gateway)...)
+		}
+	}
+
+	return requests
+}
+
+// Returns the keys of the Gateways a VirtualService is bound to. These
+// are given as "<namespace>/<name>", or just "<name>" for Gateways in
+// the VirtualService's namespace. The reserved "mesh" gateway is skipped.
+func istioGatewayKeys(vs *unstructured.Unstructured) []client.ObjectKey {
+	names, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "gateways")
+
+	var keys []client.ObjectKey
+	for _, name := range names {
+		if name == "mesh" {
+			continue
+		}
+
+		key := client.ObjectKey{Namespace: vs.GetNamespace(), Name: name}
+		if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+			key = client.ObjectKey{Namespace: parts[0], Name: parts[1]}
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Checks if an Istio Gateway server's hosts accept every one of the
+// hosts. Server hosts may be prefixed with a namespace, which is
+// ignored, and "*" accepts any host.
+func serverCoversAll(serverHosts []string, hosts []string) bool {
+	names := make([]string, len(serverHosts))
+	for i, name := range serverHosts {
+		if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+			name = parts[1]
+		}
+		if name == "*" {
+			return true
+		}
+		names[i] = name
+	}
+
+	for _, host := range hosts {
+		if !resolver.CoversHost(names, host) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
+)
+
+// +kubebuilder:rbac:groups=cdn.redcoat.dev,resources=distributions,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch
+
+// How OpenShift's insecureEdgeTerminationPolicy maps onto a
+// Distribution's TLS mode
+var routeTLSModes = map[string]string{
+	"Redirect": "redirect",
+	"Allow":    "both",
+	"None":     "only",
+	"":         "only",
+}
+
+type RouteReconciler struct {
+	client.Client
+
+	// The current scheme we are working with
+	Scheme *runtime.Scheme
+
+	// Limits which resources are considered
+	Filter SourceFilter
+
+	// Used to record events against Routes
+	Recorder record.EventRecorder
+}
+
+// Checks if OpenShift's Route CRD is installed in the cluster
+func OpenShiftRoutesInstalled(mgr ctrl.Manager) bool {
+	return installed(mgr, resolver.RouteGVK)
+}
+
+// Creates a new RouteController
+func NewRouteController(mgr ctrl.Manager, filter SourceFilter) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(resolver.NewRoute(), builder.WithPredicates(filter.predicate())).
+		Owns(&api.Distribution{}).
+		Complete(&RouteReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Filter:   filter,
+			Recorder: mgr.GetEventRecorderFor("cdn-manager"),
+		})
+}
+
+// The main reconciliation loop
+func (r *RouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	log.V(1).Info("Route Reconciliation")
+
+	route := resolver.NewRoute()
+	if err := r.Get(ctx, req.NamespacedName, route); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	class := resolver.GetDistributionClass(route)
+
+	if !r.Filter.Matches(route) || class == nil {
+		log.V(1).Info("Route has no annotations, or is outside of the watched namespaces or selector. Removing any Distributions it owns")
+		return ctrl.Result{}, removeStaleDistributions(ctx, r.Client, r.Recorder, route, nil)
+	}
+
+	log = log.WithValues("class", class)
+	log.Info("Starting Reconciliation")
+
+	overrides, errs := resolver.ParseIngressOverrides(route)
+	for _, err := range errs {
+		log.V(-1).Info(err.Error())
+		r.Recorder.Event(route, corev1.EventTypeWarning, "InvalidAnnotation", err.Error())
+	}
+
+	desired, warning := getRouteDistribution(route, *class, &overrides)
+	if desired.Spec.Origin.Host == "" {
+		log.V(-1).Info("Unable to determine origin for route. Skipping")
+		return ctrl.Result{}, nil
+	}
+
+	if warning != "" {
+		log.V(-1).Info(warning)
+		r.Recorder.Event(route, corev1.EventTypeWarning, "HostNotCovered", warning)
+	}
+
+	syncDistribution(ctx, r.Client, r.Recorder, route, &desired)
+
+	return ctrl.Result{}, removeStaleDistributions(
+		ctx, r.Client, r.Recorder, route, []api.Distribution{desired},
+	)
+}
+
+// Returns a Distribution with the desired Spec for this Route, along
+// with a warning if its host cannot be served over TLS
+//
+// The origin is the canonical host name of the router which admitted
+// the Route. Routes hold their certificates inline, so the Distribution
+// refers to the Route itself for its certificate.
+func getRouteDistribution(
+	route *unstructured.Unstructured,
+	class api.ObjectReference,
+	overrides *resolver.IngressOverrides,
+) (api.Distribution, string) {
+	desired := resolver.DistributionFromIngress(class, nil)
+	resolver.AddDistributionMeta(route, &desired)
+
+	ingresses, _, _ := unstructured.NestedSlice(route.Object, "status", "ingress")
+	for _, item := range ingresses {
+		if ingress, ok := item.(map[string]interface{}); ok {
+			if host := stringField(ingress, "routerCanonicalHostname", ""); host != "" {
+				desired.Spec.Origin.Host = host
+				break
+			}
+		}
+	}
+
+	hosts := overrides.Hosts
+	if hosts == nil {
+		if host, _, _ := unstructured.NestedString(route.Object, "spec", "host"); host != "" {
+			hosts = []string{host}
+		}
+	}
+	for _, host := range hosts {
+		if overrides.Includes(host) {
+			desired.Spec.Hosts = append(desired.Spec.Hosts, host)
+		}
+	}
+
+	var warning string
+	tls, _, _ := unstructured.NestedMap(route.Object, "spec", "tls")
+	if termination := stringField(tls, "termination", ""); termination != "" {
+		if termination == "passthrough" || stringField(tls, "certificate", "") == "" {
+			warning = fmt.Sprintf(
+				"Route %v does not have an inline certificate, so its host will be served over plain HTTP",
+				route.GetName(),
+			)
+		} else {
+			mode, ok := routeTLSModes[stringField(tls, "insecureEdgeTerminationPolicy", "")]
+			if !ok {
+				mode = "redirect"
+			}
+
+			desired.Spec.TLS = &api.TLSSpec{
+				CertificateRef: &api.ObjectReference{
+					Kind: resolver.RouteGVK.Kind,
+					Name: route.GetName(),
+				},
+				Mode: mode,
+			}
+		}
+	}
+
+	overrides.Apply(&desired)
+
+	return desired, warning
+}
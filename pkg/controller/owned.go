@@ -0,0 +1,156 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// Creates the desired Distribution for a resource (eg an Ingress), or
+// updates it if it already exists
+//
+// If the Distribution's class has changed, it is deleted instead, and is
+// recreated by a later reconcile, once the old one has been removed.
+// Distributions which are not controlled by the resource are never
+// updated or deleted.
+func syncDistribution(
+	ctx context.Context,
+	c client.Client,
+	recorder record.EventRecorder,
+	owner client.Object,
+	desired *api.Distribution,
+) {
+	log := ctrl.LoggerFrom(ctx).WithValues("distribution", desired.Name)
+
+	var distro api.Distribution
+	err := c.Get(ctx, client.ObjectKeyFromObject(desired), &distro)
+
+	if err != nil {
+		err := c.Create(ctx, desired)
+		if err != nil {
+			log.V(-3).Error(err, "Couldn't create distribution")
+			recorder.Event(owner, corev1.EventTypeWarning, "DistributionError", err.Error())
+		} else {
+			recorder.Eventf(owner, corev1.EventTypeNormal, "DistributionCreated", "Created Distribution %v", desired.Name)
+		}
+	} else if !distro.DeletionTimestamp.IsZero() {
+		log.V(1).Info("Waiting for the previous Distribution to be deleted")
+	} else if !metav1.IsControlledBy(&distro, owner) {
+		reportConflict(ctx, recorder, owner, distro)
+	} else if distro.Spec.DistributionClassRef != desired.Spec.DistributionClassRef {
+		// A different class can mean a different provider or account, so
+		// rather than being updated in place, the Distribution is deleted
+		// (which removes its external resources, according to its
+		// deletion policy) and then recreated once it has gone
+		err := c.Delete(ctx, &distro)
+		if err != nil {
+			log.V(-3).Error(err, "Couldn't delete distribution")
+			recorder.Event(owner, corev1.EventTypeWarning, "DistributionError", err.Error())
+		} else {
+			recorder.Eventf(
+				owner,
+				corev1.EventTypeNormal,
+				"DistributionMigrating",
+				"Deleting Distribution %v to move it from %v %v to %v %v",
+				distro.Name,
+				distro.Spec.DistributionClassRef.Kind,
+				distro.Spec.DistributionClassRef.Name,
+				desired.Spec.DistributionClassRef.Kind,
+				desired.Spec.DistributionClassRef.Name,
+			)
+		}
+	} else {
+		if !reflect.DeepEqual(desired.Spec, distro.Spec) {
+			log.V(1).Info("Distribution is out of sync!")
+
+			distro.Spec = desired.Spec
+			err := c.Update(ctx, &distro)
+			if err != nil {
+				log.V(-3).Error(err, "Couldn't update distribution")
+				recorder.Event(owner, corev1.EventTypeWarning, "DistributionError", err.Error())
+			} else {
+				recorder.Eventf(owner, corev1.EventTypeNormal, "DistributionUpdated", "Updated Distribution %v", distro.Name)
+			}
+		}
+	}
+}
+
+// Records that the Distribution a resource wants already exists, but
+// belongs to something else (eg another resource of a different kind
+// with the same name, or one created by hand), so it has been left alone
+func reportConflict(
+	ctx context.Context,
+	recorder record.EventRecorder,
+	owner client.Object,
+	distro api.Distribution,
+) {
+	ctrl.LoggerFrom(ctx).Info("Distribution is controlled by something else", "distribution", distro.Name)
+	recorder.Eventf(
+		owner,
+		corev1.EventTypeWarning,
+		"DistributionConflict",
+		"Distribution %v already exists, and is not controlled by this resource, so it has been left alone",
+		distro.Name,
+	)
+}
+
+// Deletes any Distributions owned by the resource which are no longer
+// needed, eg because an Ingress' TLS entry or annotation has been removed
+//
+// The Distributions' deletion policies decide what happens to their
+// external resources.
+func removeStaleDistributions(
+	ctx context.Context,
+	c client.Client,
+	recorder record.EventRecorder,
+	owner client.Object,
+	desired []api.Distribution,
+) error {
+	var distros api.DistributionList
+	if err := c.List(ctx, &distros, client.InNamespace(owner.GetNamespace())); err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, distro := range desired {
+		wanted[distro.Name] = true
+	}
+
+	for i := range distros.Items {
+		distro := &distros.Items[i]
+		if wanted[distro.Name] || !metav1.IsControlledBy(distro, owner) || !distro.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		if err := c.Delete(ctx, distro); client.IgnoreNotFound(err) != nil {
+			recorder.Event(owner, corev1.EventTypeWarning, "DistributionError", err.Error())
+			return err
+		}
+		recorder.Eventf(owner, corev1.EventTypeNormal, "DistributionDeleted", "Deleted Distribution %v", distro.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// Annotations which CDN Manager publishes onto Ingresses
+const (
+	// The endpoints of the Ingress' Distributions, comma separated
+	AnnotationEndpoint = "cdn.redcoat.dev/endpoint"
+
+	// "true" once all of the Ingress' Distributions are ready
+	AnnotationReady = "cdn.redcoat.dev/ready"
+
+	// Set when the Ingress' status has been rewritten to point at its
+	// Distributions, so that the change can be reverted
+	AnnotationStatusPublished = "cdn.redcoat.dev/status-published"
+)
+
+// Publishes the endpoints of the Ingress' Distributions back onto the
+// Ingress, as annotations, and (if enabled) in its load balancer status
+//
+// The status is only rewritten once the Distributions are ready, so
+// that tools like external-dns don't point at them too early. It is
+// never rewritten if the origin is taken from the Ingress' own status,
+// as the Distributions would then point at themselves.
+func (r *IngressReconciler) publishEndpoints(
+	ctx context.Context,
+	ingress *networking.Ingress,
+	desired []api.Distribution,
+) error {
+	if !r.PublishEndpoints && !r.PublishStatus {
+		return nil
+	}
+
+	var hosts []string
+	var lb []corev1.LoadBalancerIngress
+	ready := true
+	for i := range desired {
+		var distro api.Distribution
+		if err := r.Get(ctx, client.ObjectKeyFromObject(&desired[i]), &distro); err != nil {
+			ready = false
+			continue
+		}
+
+		ready = ready && distro.Status.Ready
+		for _, endpoint := range distro.Status.Endpoints {
+			if endpoint.Host != "" {
+				hosts = append(hosts, endpoint.Host)
+			}
+			lb = append(lb, corev1.LoadBalancerIngress{
+				Hostname: endpoint.Host,
+				IP:       endpoint.IP,
+			})
+		}
+	}
+
+	publishStatus := r.PublishStatus && ready && len(lb) > 0
+	if publishStatus && r.getIngressService(ingress) == nil {
+		r.Recorder.Event(
+			ingress,
+			corev1.EventTypeWarning,
+			"StatusNotPublished",
+			"The origin is taken from this Ingress' status, so it cannot be rewritten. Set --ingress-service or --ingress-class-services.",
+		)
+		publishStatus = false
+	}
+
+	annotations := map[string]string{}
+	if r.PublishEndpoints {
+		annotations[AnnotationEndpoint] = strings.Join(hosts, ",")
+		annotations[AnnotationReady] = strconv.FormatBool(ready)
+	}
+	if publishStatus || ingress.Annotations[AnnotationStatusPublished] != "" {
+		annotations[AnnotationStatusPublished] = "true"
+	}
+	if err := r.patchAnnotations(ctx, ingress, annotations); err != nil {
+		return err
+	}
+
+	if publishStatus {
+		return r.patchLoadBalancerStatus(ctx, ingress, lb)
+	}
+
+	return nil
+}
+
+// Removes anything published onto the Ingress by publishEndpoints,
+// putting its status back to the ingress controller's address
+func (r *IngressReconciler) unpublishEndpoints(
+	ctx context.Context,
+	ingress *networking.Ingress,
+) error {
+	statusPublished := ingress.Annotations[AnnotationStatusPublished] != ""
+
+	if err := r.patchAnnotations(ctx, ingress, map[string]string{
+		AnnotationEndpoint:        "",
+		AnnotationReady:           "",
+		AnnotationStatusPublished: "",
+	}); err != nil {
+		return err
+	}
+
+	if !statusPublished {
+		return nil
+	}
+
+	var lb []corev1.LoadBalancerIngress
+	if service := r.getIngressService(ingress); service != nil {
+		var svc corev1.Service
+		if err := r.Get(ctx, *service, &svc); err != nil {
+			return err
+		}
+		lb = svc.Status.LoadBalancer.Ingress
+	}
+
+	return r.patchLoadBalancerStatus(ctx, ingress, lb)
+}
+
+// Sets the given annotations on the Ingress, removing any with empty
+// values, and patches it if anything has changed
+func (r *IngressReconciler) patchAnnotations(
+	ctx context.Context,
+	ingress *networking.Ingress,
+	annotations map[string]string,
+) error {
+	patch := client.MergeFrom(ingress.DeepCopy())
+	changed := false
+
+	for key, value := range annotations {
+		if current, ok := ingress.Annotations[key]; value == "" && ok {
+			delete(ingress.Annotations, key)
+			changed = true
+		} else if value != "" && current != value {
+			if ingress.Annotations == nil {
+				ingress.Annotations = map[string]string{}
+			}
+			ingress.Annotations[key] = value
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return r.Patch(ctx, ingress, patch)
+}
+
+// Sets the Ingress' load balancer status, if it has changed
+func (r *IngressReconciler) patchLoadBalancerStatus(
+	ctx context.Context,
+	ingress *networking.Ingress,
+	lb []corev1.LoadBalancerIngress,
+) error {
+	if reflect.DeepEqual(ingress.Status.LoadBalancer.Ingress, lb) {
+		return nil
+	}
+
+	patch := client.MergeFrom(ingress.DeepCopy())
+	ingress.Status.LoadBalancer.Ingress = lb
+
+	return r.Status().Patch(ctx, ingress, patch)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
+)
+
+// +kubebuilder:rbac:groups=cdn.redcoat.dev,resources=distributions,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;watch;list
+
+type ServiceReconciler struct {
+	client.Client
+
+	// The current scheme we are working with
+	Scheme *runtime.Scheme
+
+	// Limits which resources are considered
+	Filter SourceFilter
+
+	// Used to record events against Services
+	Recorder record.EventRecorder
+}
+
+// Creates a new ServiceController
+func NewServiceController(mgr ctrl.Manager, filter SourceFilter) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Service{}, builder.WithPredicates(filter.predicate())).
+		Owns(&api.Distribution{}).
+		Complete(&ServiceReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Filter:   filter,
+			Recorder: mgr.GetEventRecorderFor("cdn-manager"),
+		})
+}
+
+// The main reconciliation loop
+func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	log.V(1).Info("Service Reconciliation")
+
+	var svc corev1.Service
+	if err := r.Get(ctx, req.NamespacedName, &svc); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	class := resolver.GetDistributionClass(&svc)
+
+	if !r.Filter.Matches(&svc) || class == nil || svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		log.V(1).Info("Service has no annotations, is not a LoadBalancer, or is outside of the watched namespaces or selector. Removing any Distributions it owns")
+		return ctrl.Result{}, removeStaleDistributions(ctx, r.Client, r.Recorder, &svc, nil)
+	}
+
+	log = log.WithValues("class", class)
+	log.Info("Starting Reconciliation")
+
+	overrides, errs := resolver.ParseIngressOverrides(&svc)
+	secretName, err := resolver.GetTLSSecret(&svc)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, err := range errs {
+		log.V(-1).Info(err.Error())
+		r.Recorder.Event(&svc, corev1.EventTypeWarning, "InvalidAnnotation", err.Error())
+	}
+
+	desired := getServiceDistribution(&svc, *class, secretName, &overrides)
+	if desired.Spec.Origin.Host == "" {
+		log.V(-1).Info("Unable to determine origin for service. Skipping")
+		return ctrl.Result{}, nil
+	}
+
+	syncDistribution(ctx, r.Client, r.Recorder, &svc, &desired)
+
+	return ctrl.Result{}, removeStaleDistributions(
+		ctx, r.Client, r.Recorder, &svc, []api.Distribution{desired},
+	)
+}
+
+// Returns a Distribution with the desired Spec for this Service
+//
+// Services have no host names or certificates of their own, so these are
+// only taken from the annotations.
+func getServiceDistribution(
+	svc *corev1.Service,
+	class api.ObjectReference,
+	secretName string,
+	overrides *resolver.IngressOverrides,
+) api.Distribution {
+	desired := resolver.DistributionFromIngress(class, svc.Status.LoadBalancer.Ingress)
+	resolver.AddDistributionMeta(svc, &desired)
+
+	origin := &desired.Spec.Origin
+	origin.HTTPPort = servicePort(svc, "http", origin.HTTPPort)
+	origin.HTTPSPort = servicePort(svc, "https", origin.HTTPSPort)
+
+	for _, host := range overrides.Hosts {
+		if overrides.Includes(host) {
+			desired.Spec.Hosts = append(desired.Spec.Hosts, host)
+		}
+	}
+
+	if secretName != "" {
+		desired.Spec.TLS = &api.TLSSpec{
+			SecretRef: secretName,
+			Mode:      "redirect",
+		}
+	}
+
+	overrides.Apply(&desired)
+
+	return desired
+}
+
+// Returns the number of the Service's port with the given name, or the
+// default if there is no port with that name
+func servicePort(svc *corev1.Service, name string, def int32) int32 {
+	for _, port := range svc.Spec.Ports {
+		if port.Name == name {
+			return port.Port
+		}
+	}
+
+	return def
+}
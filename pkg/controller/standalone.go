@@ -0,0 +1,59 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"gitlab.com/redcoat/cdn-manager/pkg/standalone"
+)
+
+// Sets up a Distribution controller which reads Distributions and
+// DistributionClasses from a standalone bundle, rather than from the
+// api-server, for clusters where the CRDs cannot be installed
+//
+// There are no watches on the resources the Distributions refer to in
+// this mode, so changes to them (eg certificate renewals) are picked up
+// when the bundle is next reloaded.
+//
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=create;update
+func NewStandaloneDistributionController(
+	mgr ctrl.Manager,
+	bundle *standalone.Client,
+	logger logr.Logger,
+	opts DistributionOptions,
+) error {
+	if err := mgr.Add(bundle); err != nil {
+		return err
+	}
+
+	reconciler, err := newDistributionReconciler(mgr, bundle, logger, opts)
+	if err != nil {
+		return err
+	}
+
+	c, err := crcontroller.New("distribution", mgr, crcontroller.Options{Reconciler: reconciler})
+	if err != nil {
+		return err
+	}
+
+	return c.Watch(&source.Channel{Source: bundle.Events()}, &handler.EnqueueRequestForObject{})
+}
@@ -20,6 +20,7 @@ import (
 	"reflect"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -37,3 +38,15 @@ func BuildIndexedReferenceWatcher(
 		ClusterScope: strings.HasPrefix(name, "Cluster"),
 	}
 }
+
+// As BuildIndexedReferenceWatcher, for types used via unstructured
+// objects, which are indexed by their Kind
+func BuildUnstructuredReferenceWatcher(
+	client client.Client,
+	obj *unstructured.Unstructured,
+) (source.Source, handler.EventHandler) {
+	return &source.Kind{Type: obj}, &EnqueueRequestForIndexedReference{
+		Client: client,
+		Field:  obj.GetKind(),
+	}
+}
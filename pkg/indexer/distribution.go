@@ -27,11 +27,17 @@ import (
 // These are:
 // - DistributionClasses referenced in DistributionClassRef
 // - ClusterDistributionClasses referenced in DistributionClassRef
-// - Secrets referenced in TLS.SecretRef
+// - Secrets referenced in TLS.SecretRef or SignedURLs.SecretRef
+// - Ingresses, Services and Gateways referenced in Origin.TargetRef
+// - OpenShift Routes referenced in TLS.CertificateRef
 func SetUpDistributionIndexers(mgr ctrl.Manager) {
-	NewIndexer(mgr, "Secret", GetSecretRef)
+	NewIndexer(mgr, "Secret", GetSecretRefs)
 	NewObjectReferenceIndexer(mgr, "DistributionClass", GetDistributionClassRef)
 	NewObjectReferenceIndexer(mgr, "ClusterDistributionClass", GetDistributionClassRef)
+	NewObjectReferenceIndexer(mgr, "Ingress", GetTargetRef)
+	NewObjectReferenceIndexer(mgr, "Service", GetTargetRef)
+	NewObjectReferenceIndexer(mgr, "Gateway", GetTargetRef)
+	NewObjectReferenceIndexer(mgr, "Route", GetCertificateRef)
 }
 
 // Returns the DistributionClassRef for the given Distribution
@@ -39,13 +45,38 @@ func GetDistributionClassRef(distro api.Distribution) api.ObjectReference {
 	return distro.Spec.DistributionClassRef
 }
 
-// Returns the secret name for the given Distribution
+// Returns the Origin.TargetRef for the given Distribution, or an empty
+// reference if it does not have one
+func GetTargetRef(distro api.Distribution) api.ObjectReference {
+	if ref := distro.Spec.Origin.TargetRef; ref != nil {
+		return *ref
+	}
+
+	return api.ObjectReference{}
+}
+
+// Returns the TLS.CertificateRef for the given Distribution, or an empty
+// reference if it does not have one
+func GetCertificateRef(distro api.Distribution) api.ObjectReference {
+	if tls := distro.Spec.TLS; tls != nil && tls.CertificateRef != nil {
+		return *tls.CertificateRef
+	}
+
+	return api.ObjectReference{}
+}
+
+// Returns the secret names for the given Distribution
 //
-// If TLS is not specified, an empty string is returned.
-func GetSecretRef(distro api.Distribution) string {
-	if tlsSpec := distro.Spec.TLS; tlsSpec != nil {
-		return tlsSpec.SecretRef
-	} else {
-		return ""
+// These are the TLS certificate secret and the URL signing key secret,
+// if either is specified.
+func GetSecretRefs(distro api.Distribution) []string {
+	secrets := []string{}
+	if tlsSpec := distro.Spec.TLS; tlsSpec != nil && tlsSpec.CertificateRef == nil {
+		secrets = append(secrets, tlsSpec.SecretRef)
 	}
+	if signed := distro.Spec.SignedURLs; signed != nil {
+		secrets = append(secrets, signed.SecretRef)
+	}
+
+	return secrets
 }
@@ -25,28 +25,29 @@ import (
 	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
 )
 
-// Returns the value of a field for a given Distribution to be used by
+// Returns the values of a field for a given Distribution to be used by
 // the FieldIndexer
 //
-// This is a more specific func of the client.IndexerFunc, tailored to a
-// kubernetes-compatible single key, and Distribution resources.
-type IndexerFunc func(api.Distribution) string
+// This is a more specific func of the client.IndexerFunc, tailored to
+// Distribution resources.
+type IndexerFunc func(api.Distribution) []string
 
 // Indexes a new field on Distributions with the given index key and
 // using the given IndexerFunc to extract the field
 //
-// In the event that the IndexerFunc returns an emtpty string, no fields
-// will be indexed.
+// Any empty strings returned by the IndexerFunc are not indexed.
 func NewIndexer(mgr ctrl.Manager, key string, indexer IndexerFunc) {
 	ctx := context.TODO()
 	mgr.GetFieldIndexer().IndexField(ctx, &api.Distribution{}, key,
 		func(obj client.Object) []string {
-			value := indexer(*obj.(*api.Distribution))
-			if value != "" {
-				return []string{value}
-			} else {
-				return []string{}
+			values := []string{}
+			for _, value := range indexer(*obj.(*api.Distribution)) {
+				if value != "" {
+					values = append(values, value)
+				}
 			}
+
+			return values
 		},
 	)
 }
@@ -64,11 +65,11 @@ type ObjReference func(api.Distribution) api.ObjectReference
 // empty string is returned. Otherwise the Object Reference's name is
 // returned.
 func NewObjectReferenceIndexer(mgr ctrl.Manager, kind string, indexer ObjReference) {
-	NewIndexer(mgr, kind, func(distro api.Distribution) string {
+	NewIndexer(mgr, kind, func(distro api.Distribution) []string {
 		if ref := indexer(distro); ref.Kind == kind {
-			return ref.Name
+			return []string{ref.Name}
 		} else {
-			return ""
+			return nil
 		}
 	})
 }
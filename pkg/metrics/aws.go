@@ -0,0 +1,63 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"gitlab.com/redcoat/cdn-manager/pkg/util"
+)
+
+// The name of the handler added to AWS sessions
+const awsHandlerName = "cdn-manager/metrics"
+
+// Adds handlers to the given AWS session to record the number and
+// latency of the API calls made with it
+//
+// Every client created from the session inherits the handlers. Calling
+// this more than once on the same session has no further effect.
+func InstrumentAwsSession(sess *session.Session, provider string) {
+	handler := request.NamedHandler{
+		Name: awsHandlerName,
+		Fn: func(r *request.Request) {
+			code := "OK"
+			if r.Error != nil {
+				code = "Unknown"
+				if awsErr, ok := r.Error.(awserr.Error); ok {
+					code = awsErr.Code()
+				}
+			}
+
+			service := r.ClientInfo.ServiceName
+			operation := util.AwsOperationName(r.Operation.Name)
+			ProviderAPICalls.
+				WithLabelValues(provider, service, operation, code).
+				Inc()
+			ProviderAPICallDuration.
+				WithLabelValues(provider, service, operation).
+				Observe(time.Since(r.Time).Seconds())
+		},
+	}
+
+	if !sess.Handlers.Complete.Swap(awsHandlerName, handler) {
+		sess.Handlers.Complete.PushBackNamed(handler)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// The states Distributions are counted under
+const (
+	StateReady    = "ready"
+	StatePending  = "pending"
+	StateDeleting = "deleting"
+)
+
+var distributionsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "distributions"),
+	"Number of Distributions by state and class",
+	[]string{"class_kind", "class", "state"},
+	nil,
+)
+
+// The DistributionCollector counts the Distributions in the cluster by
+// their state and class each time metrics are scraped
+//
+// This reads from the manager's cache, so it does not add any load on
+// the api-server.
+type DistributionCollector struct {
+	client.Reader
+}
+
+// Creates a DistributionCollector and registers it with the
+// controller-runtime metrics registry
+func RegisterDistributionCollector(reader client.Reader) error {
+	return metrics.Registry.Register(&DistributionCollector{Reader: reader})
+}
+
+func (c *DistributionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- distributionsDesc
+}
+
+func (c *DistributionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var list api.DistributionList
+	if err := c.List(ctx, &list); err != nil {
+		ch <- prometheus.NewInvalidMetric(distributionsDesc, err)
+		return
+	}
+
+	type key struct{ kind, name, state string }
+	counts := map[key]int{}
+	for _, distro := range list.Items {
+		ref := distro.Spec.DistributionClassRef
+		counts[key{ref.Kind, ref.Name, distributionState(distro)}]++
+	}
+
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			distributionsDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			k.kind, k.name, k.state,
+		)
+	}
+}
+
+// Works out which state a Distribution should be counted under
+func distributionState(distro api.Distribution) string {
+	if !distro.DeletionTimestamp.IsZero() {
+		return StateDeleting
+	} else if distro.Status.Ready {
+		return StateReady
+	}
+
+	return StatePending
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the domain specific Prometheus metrics exposed
+// by the controller
+//
+// All metrics are registered with controller-runtime's registry, so they
+// are served on the manager's metrics endpoint alongside its built-in
+// metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "cdn_manager"
+
+var (
+	// The number of calls made to a provider's API
+	ProviderAPICalls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "provider_api_calls_total",
+			Help:      "Number of calls made to CDN provider APIs, by error code",
+		},
+		[]string{"provider", "service", "operation", "code"},
+	)
+
+	// How long calls to a provider's API took, including retries
+	ProviderAPICallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "provider_api_call_duration_seconds",
+			Help:      "Latency of calls made to CDN provider APIs",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"provider", "service", "operation"},
+	)
+
+	// How long it took new Distributions to first become deployed
+	TimeToDeployed = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "distribution_time_to_deployed_seconds",
+			Help:      "Time from a Distribution being created to it first being deployed",
+			// CloudFront typically takes between 5 and 30 minutes
+			Buckets: []float64{60, 120, 300, 600, 900, 1200, 1800, 2700, 3600, 7200},
+		},
+		[]string{"class"},
+	)
+
+	// The number of days until each Distribution's certificate expires
+	CertificateExpiryDays = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "certificate_expiry_days",
+			Help:      "Days until the TLS certificate of a Distribution expires",
+		},
+		[]string{"namespace", "distribution"},
+	)
+
+	// The number of times an external distribution was updated to revert
+	// changes made outside of the controller
+	DriftCorrections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "drift_corrections_total",
+			Help:      "Number of updates applied to revert changes made outside of the controller",
+		},
+		[]string{"provider"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		ProviderAPICalls,
+		ProviderAPICallDuration,
+		TimeToDeployed,
+		CertificateExpiryDays,
+		DriftCorrections,
+	)
+}
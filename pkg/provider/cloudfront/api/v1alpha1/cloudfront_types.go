@@ -16,6 +16,10 @@ limitations under the License.
 
 package v1alpha1
 
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 // The access details for cloudfront distributions
 // If this section is provided, a cloudfront distribution will be setup,
 // even if access details are not given in this block.
@@ -54,3 +58,69 @@ type CloudFrontSpec struct {
 	// or DELETE, all methods are enabled.
 	SupportedMethods []string `json:"supportedMethods"`
 }
+
+// Provider specific state for CloudFront distributions
+// +kubebuilder:object:generate=true
+type CloudFrontStatus struct {
+	// The Id of the Origin Access Control used by S3 origins
+	// +optional
+	OriginAccessControlId string `json:"originAccessControlId,omitempty"`
+
+	// The S3 bucket whose policy has been updated to grant the
+	// distribution read access
+	// +optional
+	PatchedBucket *BucketReference `json:"patchedBucket,omitempty"`
+
+	// The Id of the Key Group trusted to sign URLs
+	// +optional
+	KeyGroupId string `json:"keyGroupId,omitempty"`
+
+	// The Public Keys in the Key Group, oldest first. There is normally
+	// only one, except during key rotation.
+	// +optional
+	PublicKeys []PublicKeyStatus `json:"publicKeys,omitempty"`
+
+	// The Id of the staging distribution used to roll out changes
+	// +optional
+	StagingDistributionId string `json:"stagingDistributionId,omitempty"`
+
+	// The Id of the Continuous Deployment Policy linking the staging
+	// distribution to the primary distribution
+	// +optional
+	ContinuousDeploymentPolicyId string `json:"continuousDeploymentPolicyId,omitempty"`
+
+	// A hash of the distribution config when it was last seen to match
+	// the Distribution. This is used to tell changes made outside of the
+	// controller apart from changes to the Distribution.
+	// +optional
+	AppliedConfigHash string `json:"appliedConfigHash,omitempty"`
+
+	// The ETag of the distribution's config when the controller last
+	// loaded or changed it. If it changes in between, the distribution
+	// has been changed by something else.
+	// +optional
+	ETag string `json:"etag,omitempty"`
+}
+
+// Details of a Public Key uploaded to CloudFront
+// +kubebuilder:object:generate=true
+type PublicKeyStatus struct {
+	// The Id of the Public Key (also known as the Key Pair Id)
+	Id string `json:"id"`
+
+	// The SHA-256 fingerprint of the key, used to detect rotations
+	Fingerprint string `json:"fingerprint"`
+
+	// The time the key was uploaded
+	CreatedAt metav1.Time `json:"createdAt"`
+}
+
+// A reference to an S3 bucket
+// +kubebuilder:object:generate=true
+type BucketReference struct {
+	// The name of the bucket
+	Name string `json:"name"`
+
+	// The region the bucket lives in
+	Region string `json:"region"`
+}
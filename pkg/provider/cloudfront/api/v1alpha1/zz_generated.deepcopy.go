@@ -64,6 +64,21 @@ func (in *AwsJwtAuth) DeepCopy() *AwsJwtAuth {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketReference) DeepCopyInto(out *BucketReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketReference.
+func (in *BucketReference) DeepCopy() *BucketReference {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudFrontSpec) DeepCopyInto(out *CloudFrontSpec) {
 	*out = *in
@@ -89,6 +104,33 @@ func (in *CloudFrontSpec) DeepCopy() *CloudFrontSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudFrontStatus) DeepCopyInto(out *CloudFrontStatus) {
+	*out = *in
+	if in.PatchedBucket != nil {
+		in, out := &in.PatchedBucket, &out.PatchedBucket
+		*out = new(BucketReference)
+		**out = **in
+	}
+	if in.PublicKeys != nil {
+		in, out := &in.PublicKeys, &out.PublicKeys
+		*out = make([]PublicKeyStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudFrontStatus.
+func (in *CloudFrontStatus) DeepCopy() *CloudFrontStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudFrontStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespacedName) DeepCopyInto(out *NamespacedName) {
 	*out = *in
@@ -108,3 +150,19 @@ func (in *NamespacedName) DeepCopy() *NamespacedName {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PublicKeyStatus) DeepCopyInto(out *PublicKeyStatus) {
+	*out = *in
+	in.CreatedAt.DeepCopyInto(&out.CreatedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PublicKeyStatus.
+func (in *PublicKeyStatus) DeepCopy() *PublicKeyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PublicKeyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -26,7 +26,9 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts"
 	corev1rest "k8s.io/client-go/kubernetes/typed/core/v1"
 
+	"gitlab.com/redcoat/cdn-manager/pkg/metrics"
 	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/tracing"
 )
 
 // The AwsAuthProvider is used to create a session based on a kubernetes
@@ -39,21 +41,32 @@ type AwsAuthProvider struct {
 	stsApi      *sts.STS
 	sessionName string
 	corev1      *corev1rest.CoreV1Interface
+	limiter     *accountLimiter
 }
 
 // Creates an AwsAuthProvider, with the given sessionName and kubernetes
-// client.
-func NewAwsAuthProvider(sessionName string, corev1 *corev1rest.CoreV1Interface) (*AwsAuthProvider, error) {
+// client. All of the sessions it creates share the given rate limit.
+func NewAwsAuthProvider(
+	sessionName string,
+	corev1 *corev1rest.CoreV1Interface,
+	limit RateLimit,
+) (*AwsAuthProvider, error) {
+	limiter := newAccountLimiter(limit)
+
 	sess, err := newSession()
 	if err != nil {
 		return nil, err
 	}
 
+	// The controller's own credentials all share one bucket
+	limiter.instrument(sess, "")
+
 	return &AwsAuthProvider{
 		session:     sess,
 		stsApi:      sts.New(sess),
 		sessionName: sessionName,
 		corev1:      corev1,
+		limiter:     limiter,
 	}, nil
 }
 
@@ -64,6 +77,8 @@ func newSession() (*session.Session, error) {
 		return nil, err
 	}
 
+	metrics.InstrumentAwsSession(sess, "cloudfront")
+	tracing.InstrumentAwsSession(sess, "cloudfront")
 	return sess, nil
 }
 
@@ -71,18 +86,25 @@ func newSession() (*session.Session, error) {
 // were loaded from a namespace, any referenced Secrets or Service
 // Accountswill be loaded from that same namespace. Otherwise, it will
 // read the namespace from the AwsAuth details.
-func (p *AwsAuthProvider) NewSession(details *cfapi.AwsAuth, namespace *string) (*session.Session, error) {
+func (p *AwsAuthProvider) NewSession(
+	ctx context.Context,
+	details *cfapi.AwsAuth,
+	namespace *string,
+) (sess *session.Session, err error) {
 	if details == nil {
 		return p.session, nil
 	}
 
+	ctx, span := tracing.Start(ctx, "AwsAuth.NewSession")
+	defer tracing.End(span, &err)
+
 	var creds *credentials.Credentials
-	var err error
+	var account string
 
 	if details.AccessKeyRef != nil {
-		creds, err = p.credentialsForAccessKey(context.TODO(), details.AccessKeyRef, namespace)
+		creds, account, err = p.credentialsForAccessKey(ctx, details.AccessKeyRef, namespace)
 	} else if details.JWTAuth != nil {
-		creds, err = p.credentialsForJwtAuth(context.TODO(), details.JWTAuth, namespace)
+		creds, account, err = p.credentialsForJwtAuth(ctx, details.JWTAuth, namespace)
 	}
 
 	if err != nil {
@@ -92,7 +114,7 @@ func (p *AwsAuthProvider) NewSession(details *cfapi.AwsAuth, namespace *string)
 	config := aws.NewConfig()
 	config.WithCredentials(creds)
 
-	sess, err := session.NewSession(config)
+	sess, err = session.NewSession(config)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +128,11 @@ func (p *AwsAuthProvider) NewSession(details *cfapi.AwsAuth, namespace *string)
 		if err != nil {
 			return nil, err
 		}
+		account = accountForRole(details.Role)
 	}
 
+	metrics.InstrumentAwsSession(sess, "cloudfront")
+	tracing.InstrumentAwsSession(sess, "cloudfront")
+	p.limiter.instrument(sess, account)
 	return sess, nil
 }
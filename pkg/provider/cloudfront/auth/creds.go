@@ -24,33 +24,41 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/tracing"
 )
 
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
 
 // Loads static credentials from a secret
+//
+// The access key id is also returned, to be used in place of the
+// account for rate limiting, as it cannot be found without a call to
+// STS.
 func (p *AwsAuthProvider) credentialsForAccessKey(
 	ctx context.Context,
 	details *cfapi.NamespacedName,
 	namespace *string,
-) (*credentials.Credentials, error) {
+) (creds *credentials.Credentials, accessKey string, err error) {
+	ctx, span := tracing.Start(ctx, "AwsAuth.AccessKey")
+	defer tracing.End(span, &err)
+
 	if namespace == nil {
 		if namespace = details.Namespace; namespace == nil {
-			return nil, fmt.Errorf("Secret had no namespace (required for cluster-scoped resources)")
+			return nil, "", fmt.Errorf("Secret had no namespace (required for cluster-scoped resources)")
 		}
 	}
 
 	secretsApi := (*p.corev1).Secrets(*namespace)
 	secret, err := secretsApi.Get(ctx, details.Name, metav1.GetOptions{})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	accessKey := string(secret.Data["AWS_ACCESS_KEY_ID"])
+	accessKey = string(secret.Data["AWS_ACCESS_KEY_ID"])
 	secretKey := string(secret.Data["AWS_SECRET_ACCESS_KEY"])
 	if accessKey == "" || secretKey == "" {
-		return nil, fmt.Errorf("Secret missing the AWS Key")
+		return nil, "", fmt.Errorf("Secret missing the AWS Key")
 	}
 
-	return credentials.NewStaticCredentials(accessKey, secretKey, ""), nil
+	return credentials.NewStaticCredentials(accessKey, secretKey, ""), accessKey, nil
 }
@@ -27,21 +27,26 @@ import (
 	corev1rest "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/tracing"
 )
 
 // +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get
 // +kubebuilder:rbac:groups=core,resources=serviceaccounts/token,verbs=create
 
 // Generates a set of Credentials, driven by a a web identity created
-// from a ServiceAccount token.
+// from a ServiceAccount token. The account of the role being assumed is
+// also returned, for rate limiting.
 func (p *AwsAuthProvider) credentialsForJwtAuth(
 	ctx context.Context,
 	details *cfapi.AwsJwtAuth,
 	namespace *string,
-) (*credentials.Credentials, error) {
+) (creds *credentials.Credentials, account string, err error) {
+	ctx, span := tracing.Start(ctx, "AwsAuth.JWT")
+	defer tracing.End(span, &err)
+
 	if namespace == nil {
 		if namespace = details.ServiceAccount.Namespace; namespace == nil {
-			return nil, fmt.Errorf("Service Account had no namespace (required for cluster-scoped resources)")
+			return nil, "", fmt.Errorf("Service Account had no namespace (required for cluster-scoped resources)")
 		}
 	}
 
@@ -49,12 +54,12 @@ func (p *AwsAuthProvider) credentialsForJwtAuth(
 	saApi := (*p.corev1).ServiceAccounts(*namespace)
 	serviceAccount, err := saApi.Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	roleArn := serviceAccount.Annotations[details.AnnotationName]
 	if roleArn == "" {
-		return nil, fmt.Errorf("No role was annotated on the given Service Account")
+		return nil, "", fmt.Errorf("No role was annotated on the given Service Account")
 	}
 
 	return credentials.NewCredentials(stscreds.NewWebIdentityRoleProviderWithToken(
@@ -66,7 +71,7 @@ func (p *AwsAuthProvider) credentialsForJwtAuth(
 			serviceAccount: name,
 			aud:            details.Audience,
 		},
-	)), nil
+	)), accountForRole(roleArn), nil
 }
 
 // Token fetcher is an implementation of stscreds.TokenFetcher. It is
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"golang.org/x/time/rate"
+)
+
+// The name of the handler added to AWS sessions
+const rateLimitHandlerName = "cdn-manager/ratelimit"
+
+// The client side limit on the rate of AWS API calls
+type RateLimit struct {
+	// The number of calls per second allowed for each AWS account. If
+	// this is zero, calls are not limited.
+	Rate float64
+
+	// The number of calls which can be made in a burst, above the rate
+	Burst int
+}
+
+// Limits the rate of the AWS API calls made with each account
+//
+// AWS's API rate limits apply to the whole account, so all of the
+// sessions using the same account share a single token bucket, no matter
+// which Distribution they are being used for.
+//
+// The account is worked out from the auth config the session was made
+// from (see accountForRole), rather than its credentials, as temporary
+// credentials change with every session. There is one bucket for each
+// account or access key in use, so the number of buckets is bounded by
+// the number of DistributionClasses.
+type accountLimiter struct {
+	limit RateLimit
+
+	// Maps accounts onto their rate.Limiter
+	limiters sync.Map
+}
+
+func newAccountLimiter(limit RateLimit) *accountLimiter {
+	return &accountLimiter{limit: limit}
+}
+
+// Adds a handler to the given session which waits for the account's
+// token bucket before each API call is signed
+//
+// This runs before every attempt, so retries are limited too.
+func (l *accountLimiter) instrument(sess *session.Session, account string) {
+	if l.limit.Rate <= 0 {
+		return
+	}
+
+	limiter := l.limiter(account)
+	handler := request.NamedHandler{Name: rateLimitHandlerName, Fn: func(r *request.Request) {
+		if err := limiter.Wait(r.Context()); err != nil {
+			r.Error = err
+		}
+	}}
+	if !sess.Handlers.Sign.Swap(rateLimitHandlerName, handler) {
+		sess.Handlers.Sign.PushFrontNamed(handler)
+	}
+}
+
+// Returns the token bucket for the given account
+func (l *accountLimiter) limiter(account string) *rate.Limiter {
+	if limiter, ok := l.limiters.Load(account); ok {
+		return limiter.(*rate.Limiter)
+	}
+
+	limiter, _ := l.limiters.LoadOrStore(
+		account,
+		rate.NewLimiter(rate.Limit(l.limit.Rate), l.limit.Burst),
+	)
+
+	return limiter.(*rate.Limiter)
+}
+
+// Returns the account a role belongs to, which is part of its ARN
+//
+// If the ARN cannot be parsed, the whole ARN is used instead, which is
+// a less accurate, but still useful, key for the token bucket.
+func accountForRole(roleArn string) string {
+	if parsed, err := arn.Parse(roleArn); err == nil && parsed.AccountID != "" {
+		return parsed.AccountID
+	}
+
+	return roleArn
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
+)
+
+// The BucketPolicyProvider adds (and removes) a statement to an S3
+// bucket's policy, granting a CloudFront distribution read access to
+// the bucket's objects via its Origin Access Control
+type BucketPolicyProvider struct {
+	Context      context.Context
+	Config       client.ConfigProvider
+	Distribution api.Distribution
+	Status       *api.DistributionStatus
+}
+
+// A minimal representation of an IAM policy document
+//
+// Statements are left as generic maps, and any other top level fields
+// (eg Id) are kept in Extra, so that anything we did not create is
+// written back exactly as we found it. A single Statement object is
+// read as a list of one, and is written back as a list.
+type policyDocument struct {
+	Version   string                     `json:"Version"`
+	Statement []map[string]interface{}   `json:"Statement"`
+	Extra     map[string]json.RawMessage `json:"-"`
+}
+
+func (p *policyDocument) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	if version, ok := fields["Version"]; ok {
+		if err := json.Unmarshal(version, &p.Version); err != nil {
+			return err
+		}
+	}
+	if statement, ok := fields["Statement"]; ok {
+		// IAM also allows a single statement to be given on its own,
+		// rather than in a list
+		if strings.HasPrefix(strings.TrimSpace(string(statement)), "{") {
+			statement = append(append([]byte("["), statement...), ']')
+		}
+		if err := json.Unmarshal(statement, &p.Statement); err != nil {
+			return err
+		}
+	}
+
+	delete(fields, "Version")
+	delete(fields, "Statement")
+	p.Extra = fields
+
+	return nil
+}
+
+func (p policyDocument) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{}
+	for key, value := range p.Extra {
+		fields[key] = value
+	}
+	fields["Version"] = p.Version
+	fields["Statement"] = p.Statement
+
+	return json.Marshal(fields)
+}
+
+// Sets up a new instance of the BucketPolicyProvider
+func NewBucketPolicyProvider(
+	ctx context.Context,
+	cfg client.ConfigProvider,
+	distro api.Distribution,
+	status *api.DistributionStatus,
+) *BucketPolicyProvider {
+	return &BucketPolicyProvider{
+		Context:      ctx,
+		Config:       cfg,
+		Distribution: distro,
+		Status:       status,
+	}
+}
+
+// Returns an S3 client for the given bucket's region
+func (c *BucketPolicyProvider) client(bucket cfapi.BucketReference) *s3.S3 {
+	return s3.New(c.Config, aws.NewConfig().WithRegion(bucket.Region))
+}
+
+// The Sid of the statement we manage in the bucket policy
+//
+// Sids may only contain alphanumeric characters, so the dashes are
+// removed from the k8s resource UID.
+func (c *BucketPolicyProvider) sid() string {
+	return "CDNManager" + strings.ReplaceAll(string(c.Distribution.UID), "-", "")
+}
+
+// Returns the bucket that the policy should be applied to, or nil if
+// the bucket policy should not be managed
+func (c *BucketPolicyProvider) desiredBucket() *cfapi.BucketReference {
+	s3 := c.Distribution.Spec.Origin.S3
+	if s3 == nil || !s3.ManageBucketPolicy {
+		return nil
+	}
+
+	return &cfapi.BucketReference{
+		Name:   s3.BucketName,
+		Region: s3.Region,
+	}
+}
+
+// Ensures the desired bucket's policy grants the given distribution ARN
+// access, removing the grant from any previously patched bucket
+func (c *BucketPolicyProvider) Reconcile(distributionArn string) error {
+	desired := c.desiredBucket()
+	patched := cloudFrontStatus(c.Status).PatchedBucket
+
+	if patched != nil && (desired == nil || *desired != *patched) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+
+	if desired == nil {
+		return nil
+	}
+
+	policy, err := c.load(*desired)
+	if err != nil {
+		return err
+	}
+
+	statement := map[string]interface{}{
+		"Sid":       c.sid(),
+		"Effect":    "Allow",
+		"Principal": map[string]interface{}{"Service": "cloudfront.amazonaws.com"},
+		"Action":    "s3:GetObject",
+		"Resource":  "arn:aws:s3:::" + desired.Name + "/*",
+		"Condition": map[string]interface{}{
+			"StringEquals": map[string]interface{}{
+				"AWS:SourceArn": distributionArn,
+			},
+		},
+	}
+
+	// Round trip the statement through JSON so that it can be compared
+	// with the statement loaded from AWS
+	var normalised map[string]interface{}
+	raw, _ := json.Marshal(statement)
+	json.Unmarshal(raw, &normalised)
+
+	found := false
+	for idx, existing := range policy.Statement {
+		if existing["Sid"] != c.sid() {
+			continue
+		}
+
+		found = true
+		if reflect.DeepEqual(existing, normalised) {
+			cloudFrontStatus(c.Status).PatchedBucket = desired
+			return nil
+		}
+		policy.Statement[idx] = normalised
+	}
+
+	if !found {
+		policy.Statement = append(policy.Statement, normalised)
+	}
+
+	if err := c.save(*desired, policy); err != nil {
+		return err
+	}
+
+	cloudFrontStatus(c.Status).PatchedBucket = desired
+	return nil
+}
+
+// Removes our statement from the previously patched bucket's policy
+func (c *BucketPolicyProvider) Delete() error {
+	status := cloudFrontStatus(c.Status)
+	defer tidyCloudFrontStatus(c.Status)
+
+	if status.PatchedBucket == nil {
+		return nil
+	}
+
+	bucket := *status.PatchedBucket
+	policy, err := c.load(bucket)
+	if is, _ := isAwsError(err, s3.ErrCodeNoSuchBucket); is {
+		status.PatchedBucket = nil
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	statements := policy.Statement[:0]
+	for _, statement := range policy.Statement {
+		if statement["Sid"] != c.sid() {
+			statements = append(statements, statement)
+		}
+	}
+	policy.Statement = statements
+
+	if err := c.save(bucket, policy); err != nil {
+		return err
+	}
+
+	status.PatchedBucket = nil
+	return nil
+}
+
+// Loads and parses the bucket's current policy
+//
+// If the bucket does not have a policy, an empty one is returned.
+func (c *BucketPolicyProvider) load(bucket cfapi.BucketReference) (*policyDocument, error) {
+	res, err := c.client(bucket).GetBucketPolicyWithContext(c.Context, &s3.GetBucketPolicyInput{
+		Bucket: aws.String(bucket.Name),
+	})
+
+	if is, _ := isAwsError(err, "NoSuchBucketPolicy"); is {
+		return &policyDocument{Version: "2012-10-17"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var policy policyDocument
+	if err := json.Unmarshal([]byte(*res.Policy), &policy); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// Writes the given policy back to the bucket
+//
+// AWS does not accept policies without any statements, so if there are
+// none left, the policy is deleted instead.
+func (c *BucketPolicyProvider) save(bucket cfapi.BucketReference, policy *policyDocument) error {
+	if len(policy.Statement) == 0 {
+		_, err := c.client(bucket).DeleteBucketPolicyWithContext(c.Context, &s3.DeleteBucketPolicyInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		return err
+	}
+
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.client(bucket).PutBucketPolicyWithContext(c.Context, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket.Name),
+		Policy: aws.String(string(raw)),
+	})
+	return err
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyDocumentUnmarshal(t *testing.T) {
+	statement := map[string]interface{}{
+		"Sid":      "Existing",
+		"Effect":   "Allow",
+		"Action":   "s3:GetObject",
+		"Resource": "arn:aws:s3:::example/*",
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  policyDocument
+	}{
+		{
+			name: "statement list",
+			input: `{"Version":"2012-10-17","Statement":[` +
+				`{"Sid":"Existing","Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::example/*"}]}`,
+			want: policyDocument{
+				Version:   "2012-10-17",
+				Statement: []map[string]interface{}{statement},
+				Extra:     map[string]json.RawMessage{},
+			},
+		},
+		{
+			name: "single statement",
+			input: `{"Version":"2012-10-17","Statement":` +
+				` {"Sid":"Existing","Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::example/*"}}`,
+			want: policyDocument{
+				Version:   "2012-10-17",
+				Statement: []map[string]interface{}{statement},
+				Extra:     map[string]json.RawMessage{},
+			},
+		},
+		{
+			name:  "extra fields",
+			input: `{"Version":"2012-10-17","Id":"ExamplePolicy","Statement":[]}`,
+			want: policyDocument{
+				Version:   "2012-10-17",
+				Statement: []map[string]interface{}{},
+				Extra:     map[string]json.RawMessage{"Id": json.RawMessage(`"ExamplePolicy"`)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got policyDocument
+			if err := json.Unmarshal([]byte(test.input), &got); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPolicyDocumentKeepsExtraFields(t *testing.T) {
+	input := `{"Version":"2012-10-17","Id":"ExamplePolicy","Statement":{"Sid":"Existing"}}`
+
+	var doc policyDocument
+	if err := json.Unmarshal([]byte(input), &doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"Id":"ExamplePolicy","Statement":[{"Sid":"Existing"}],"Version":"2012-10-17"}`
+	if string(output) != want {
+		t.Errorf("expected %v, got %v", want, string(output))
+	}
+}
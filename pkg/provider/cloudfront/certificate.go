@@ -17,6 +17,7 @@ limitations under the License.
 package cloudfront
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/service/acm"
@@ -28,18 +29,23 @@ import (
 )
 
 type CertificateProvider struct {
+	Context     context.Context
 	Client      *acm.ACM
 	Status      *api.DistributionStatus
 	Certificate *resolver.Certificate
+	Events      Events
 }
 
 // Sets up a new instance of the CertificateProvider
 func NewCertificateProvider(
+	ctx context.Context,
 	cfg client.ConfigProvider,
 	status *api.DistributionStatus,
 	cert *resolver.Certificate,
+	events Events,
 ) *CertificateProvider {
 	return &CertificateProvider{
+		Context: ctx,
 		Client: acm.New(cfg, &aws.Config{
 			// For cloudfront, all certificates have to be in the us-east-1
 			// region, regardless of anything else, so we hard code the region
@@ -48,6 +54,7 @@ func NewCertificateProvider(
 		}),
 		Status:      status,
 		Certificate: cert,
+		Events:      events,
 	}
 }
 
@@ -70,7 +77,7 @@ func (c *CertificateProvider) getSerial() string {
 }
 
 func (c *CertificateProvider) Check() error {
-	info, err := c.Client.DescribeCertificate(&acm.DescribeCertificateInput{
+	info, err := c.Client.DescribeCertificateWithContext(c.Context, &acm.DescribeCertificateInput{
 		CertificateArn: aws.String(c.Status.ExternalCertificateId),
 	})
 
@@ -88,13 +95,37 @@ func (c *CertificateProvider) Check() error {
 	return nil
 }
 
+// Works out whether the certificate needs to be imported, without
+// making any changes
+func (c *CertificateProvider) Plan() ([]string, error) {
+	if c.Status.ExternalCertificateId == "" {
+		return []string{"Import certificate into ACM"}, nil
+	}
+
+	info, err := c.Client.DescribeCertificateWithContext(c.Context, &acm.DescribeCertificateInput{
+		CertificateArn: aws.String(c.Status.ExternalCertificateId),
+	})
+
+	if is, _ := isAwsError(err, "ResourceNotFoundException"); is {
+		return []string{"Import certificate into ACM"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if c.getSerial() != *info.Certificate.Serial {
+		return []string{"Reimport certificate " + c.Status.ExternalCertificateId}, nil
+	}
+
+	return nil, nil
+}
+
 func (c *CertificateProvider) Create() error {
 	var arn *string
 	if c.Status.ExternalCertificateId != "" {
 		arn = aws.String(c.Status.ExternalCertificateId)
 	}
 
-	info, err := c.Client.ImportCertificate(&acm.ImportCertificateInput{
+	info, err := c.Client.ImportCertificateWithContext(c.Context, &acm.ImportCertificateInput{
 		Certificate:      c.Certificate.Certificate.Encoded,
 		CertificateChain: c.Certificate.Chain,
 		PrivateKey:       c.Certificate.Key,
@@ -105,12 +136,22 @@ func (c *CertificateProvider) Create() error {
 		return err
 	}
 
+	if arn != nil {
+		c.Events.Normal("CertificateRotated", "Reimported certificate %v into ACM", *arn)
+	} else {
+		c.Events.Normal("CertificateImported", "Imported certificate %v into ACM", *info.CertificateArn)
+	}
+
 	c.Status.ExternalCertificateId = *info.CertificateArn
 	return nil
 }
 
 func (c *CertificateProvider) Delete() error {
-	_, err := c.Client.DeleteCertificate(&acm.DeleteCertificateInput{
+	if c.Status.ExternalCertificateId == "" {
+		return nil
+	}
+
+	_, err := c.Client.DeleteCertificateWithContext(c.Context, &acm.DeleteCertificateInput{
 		CertificateArn: aws.String(c.Status.ExternalCertificateId),
 	})
 
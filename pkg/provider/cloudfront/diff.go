@@ -0,0 +1,226 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+)
+
+// The SDK types whose Items are sets, and so can be returned by AWS in
+// any order
+var unorderedItems = map[reflect.Type]bool{
+	reflect.TypeOf(cloudfront.Aliases{}):              true,
+	reflect.TypeOf(cloudfront.AllowedMethods{}):       true,
+	reflect.TypeOf(cloudfront.CachedMethods{}):        true,
+	reflect.TypeOf(cloudfront.CookieNames{}):          true,
+	reflect.TypeOf(cloudfront.Headers{}):              true,
+	reflect.TypeOf(cloudfront.OriginSslProtocols{}):   true,
+	reflect.TypeOf(cloudfront.QueryStringCacheKeys{}): true,
+	reflect.TypeOf(cloudfront.StatusCodes{}):          true,
+	reflect.TypeOf(cloudfront.TrustedKeyGroups{}):     true,
+}
+
+// A single field which differs between the desired and current config
+type configChange struct {
+	// The path to the field, eg "DefaultCacheBehavior.Compress"
+	Path string
+
+	Desired reflect.Value
+	Current reflect.Value
+}
+
+// Returns a human readable description of the change, for use in plans
+func (c configChange) String() string {
+	return fmt.Sprintf(
+		"%v: %v -> %v",
+		c.Path,
+		formatValue(c.Current),
+		formatValue(c.Desired),
+	)
+}
+
+// Formats a value from a config compactly, on a single line
+func formatValue(value reflect.Value) string {
+	if !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+		return "<nil>"
+	}
+
+	encoded, err := json.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprintf("%v", value.Interface())
+	}
+
+	return string(encoded)
+}
+
+// Returns the paths of the fields which differ between the desired and
+// current distribution config, eg "DefaultCacheBehavior.Compress"
+//
+// If the configs match, nil is returned.
+func diffConfig(desired, current *cloudfront.DistributionConfig) []string {
+	var paths []string
+	for _, change := range diffConfigChanges(desired, current) {
+		paths = append(paths, change.Path)
+	}
+
+	return paths
+}
+
+// Returns the fields which differ between the desired and current
+// distribution config
+func diffConfigChanges(desired, current *cloudfront.DistributionConfig) []configChange {
+	return diffValues("", reflect.ValueOf(desired), reflect.ValueOf(current))
+}
+
+// Checks if the current distribution config is semantically the same as
+// the desired config
+func configMatches(desired, current *cloudfront.DistributionConfig) bool {
+	return len(diffConfigChanges(desired, current)) == 0
+}
+
+// Returns a hash of the given config, so that it can be cheaply
+// compared with the config from a previous reconciliation
+func configHash(config *cloudfront.DistributionConfig) string {
+	encoded, _ := json.Marshal(config)
+	sum := sha256.Sum256(encoded)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Recursively compares two values of the same type, returning any fields
+// which differ
+//
+// The AWS SDK represents everything as pointers, structs and slices, so
+// these are the only kinds which are walked. Anything else is compared
+// as a whole.
+//
+// The comparison is semantic rather than exact:
+// - AWS fills in many optional fields that we do not set with their
+//   zero value (eg an empty ResponseHeadersPolicyId), so a missing value
+//   is treated as being the same as a zero one.
+// - Empty lists may be returned as nil, or vice versa.
+// - Lists which are really sets (see unorderedItems), such as Aliases,
+//   are returned in the order they were added, so are sorted before
+//   being compared.
+func diffValues(path string, desired, current reflect.Value) []configChange {
+	changed := []configChange{{Path: path, Desired: desired, Current: current}}
+
+	switch desired.Kind() {
+	case reflect.Ptr:
+		if desired.IsNil() || current.IsNil() {
+			if isZero(desired) && isZero(current) {
+				return nil
+			}
+			return changed
+		}
+
+		return diffValues(path, desired.Elem(), current.Elem())
+
+	case reflect.Struct:
+		var diffs []configChange
+		for i := 0; i < desired.NumField(); i++ {
+			field := desired.Type().Field(i)
+			if field.PkgPath != "" {
+				// Unexported (eg the SDK's _ struct{} tags)
+				continue
+			}
+
+			name := field.Name
+			if path != "" {
+				name = path + "." + name
+			}
+
+			desiredField, currentField := desired.Field(i), current.Field(i)
+			if field.Name == "Items" && unorderedItems[desired.Type()] {
+				desiredField, currentField = sortedSlice(desiredField), sortedSlice(currentField)
+			}
+
+			diffs = append(diffs, diffValues(name, desiredField, currentField)...)
+		}
+		return diffs
+
+	case reflect.Slice:
+		if desired.Len() != current.Len() {
+			return changed
+		}
+
+		var diffs []configChange
+		for i := 0; i < desired.Len(); i++ {
+			diffs = append(diffs, diffValues(
+				fmt.Sprintf("%v[%v]", path, i),
+				desired.Index(i),
+				current.Index(i),
+			)...)
+		}
+		return diffs
+
+	default:
+		if !reflect.DeepEqual(desired.Interface(), current.Interface()) {
+			return changed
+		}
+		return nil
+	}
+}
+
+// Checks if a value is empty, treating nil pointers, empty lists and
+// structs with only empty fields as all being the same
+func isZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return true
+
+	case reflect.Ptr:
+		return value.IsNil() || isZero(value.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath == "" && !isZero(value.Field(i)) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Slice:
+		return value.Len() == 0
+
+	default:
+		return value.IsZero()
+	}
+}
+
+// Returns a sorted copy of a slice, ordered by the JSON form of its
+// items
+func sortedSlice(value reflect.Value) reflect.Value {
+	if value.Kind() != reflect.Slice || value.Len() < 2 {
+		return value
+	}
+
+	sorted := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+	reflect.Copy(sorted, value)
+	sort.SliceStable(sorted.Interface(), func(i, j int) bool {
+		return formatValue(sorted.Index(i)) < formatValue(sorted.Index(j))
+	})
+
+	return sorted
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package cloudfront
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"regexp"
 	"sort"
@@ -27,30 +29,54 @@ import (
 	"github.com/aws/aws-sdk-go/service/cloudfront"
 
 	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/metrics"
 	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
 )
 
+// The number of times an update is attempted, if the distribution keeps
+// being changed by something else between it being loaded and updated
+const maxUpdateAttempts = 3
+
 type DistributionProvider struct {
+	Context      context.Context
 	Client       *cloudfront.CloudFront
 	Distribution api.Distribution
 	Class        cfapi.CloudFrontSpec
 	Status       *api.DistributionStatus
 	CurrentState *cloudfront.Distribution
 	DesiredState *cloudfront.DistributionConfig
+	Events       Events
+
+	// What to do about changes made to the distribution outside of the
+	// controller
+	DriftPolicy api.DriftPolicy
 }
 
 // Sets up a new instance of the DistributionProvider
 func NewDistributionProvider(
+	ctx context.Context,
 	cfg client.ConfigProvider,
 	class api.DistributionClassSpec,
 	distro api.Distribution,
 	status *api.DistributionStatus,
+	events Events,
 ) *DistributionProvider {
 	provider := DistributionProvider{
+		Context:      ctx,
 		Client:       cloudfront.New(cfg),
 		Class:        *class.Providers.CloudFront,
 		Distribution: distro,
 		Status:       status,
+		Events:       events,
+		DriftPolicy:  class.DriftPolicy,
+	}
+
+	if provider.DriftPolicy == "" {
+		provider.DriftPolicy = api.DriftPolicyCorrect
+	}
+
+	if distro.Spec.CachePolicyId != "" {
+		provider.Class.CachePolicyId = distro.Spec.CachePolicyId
 	}
 
 	return &provider
@@ -131,6 +157,55 @@ func (c *DistributionProvider) calculateAliases() *cloudfront.Aliases {
 	return &aliases
 }
 
+// Calculates the origin for the distribution
+//
+// This is either a custom origin, pointing at the Distribution's origin
+// host, or an S3 origin which is accessed via an Origin Access Control.
+func (c *DistributionProvider) calculateOrigin() *cloudfront.Origin {
+	spec := c.Distribution.Spec.Origin
+	origin := cloudfront.Origin{
+		ConnectionAttempts: aws.Int64(3),
+		ConnectionTimeout:  aws.Int64(10),
+		CustomHeaders: &cloudfront.CustomHeaders{
+			Quantity: aws.Int64(0),
+		},
+		OriginPath:            aws.String(""),
+		OriginAccessControlId: aws.String(""),
+	}
+
+	if spec.S3 != nil {
+		domain := spec.S3.BucketName + ".s3." + spec.S3.Region + ".amazonaws.com"
+		origin.DomainName = aws.String(domain)
+		origin.Id = aws.String(domain)
+		origin.OriginAccessControlId = aws.String(
+			cloudFrontStatus(c.Status).OriginAccessControlId,
+		)
+		// Origin Access Identities are the legacy alternative to Origin
+		// Access Controls. AWS requires this to be set, but empty.
+		origin.S3OriginConfig = &cloudfront.S3OriginConfig{
+			OriginAccessIdentity: aws.String(""),
+		}
+
+		return &origin
+	}
+
+	origin.DomainName = aws.String(spec.Host)
+	origin.Id = aws.String(spec.Host)
+	origin.CustomOriginConfig = &cloudfront.CustomOriginConfig{
+		HTTPPort:               aws.Int64(int64(spec.HTTPPort)),
+		HTTPSPort:              aws.Int64(int64(spec.HTTPSPort)),
+		OriginProtocolPolicy:   aws.String("match-viewer"),
+		OriginReadTimeout:      aws.Int64(30),
+		OriginKeepaliveTimeout: aws.Int64(30),
+		OriginSslProtocols: &cloudfront.OriginSslProtocols{
+			Quantity: aws.Int64(1),
+			Items:    aws.StringSlice([]string{"TLSv1.2"}),
+		},
+	}
+
+	return &origin
+}
+
 // Calculates the desired forwarded values for the distribution
 func (c *DistributionProvider) calculateForwardedValues() *cloudfront.ForwardedValues {
 	// If a cache policy id is set then this takes precendence. We will
@@ -140,6 +215,23 @@ func (c *DistributionProvider) calculateForwardedValues() *cloudfront.ForwardedV
 		return nil
 	}
 
+	// S3 determines the bucket from the Host header, so it must not be
+	// forwarded to S3 origins
+	if c.Distribution.Spec.Origin.S3 != nil {
+		return &cloudfront.ForwardedValues{
+			Cookies: &cloudfront.CookiePreference{
+				Forward: aws.String(cloudfront.ItemSelectionNone),
+			},
+			QueryString: aws.Bool(false),
+			QueryStringCacheKeys: &cloudfront.QueryStringCacheKeys{
+				Quantity: aws.Int64(0),
+			},
+			Headers: &cloudfront.Headers{
+				Quantity: aws.Int64(0),
+			},
+		}
+	}
+
 	return &cloudfront.ForwardedValues{
 		// Best guess defaults - if you want to change these, set a cache
 		// policy / origin request policy
@@ -159,6 +251,40 @@ func (c *DistributionProvider) calculateForwardedValues() *cloudfront.ForwardedV
 	}
 }
 
+// Calculates the Key Groups trusted to sign URLs for the distribution
+//
+// If the Distribution requires signed URLs, this is the Key Group
+// managed by the KeyGroupProvider. Otherwise signed URLs are disabled.
+func (c *DistributionProvider) calculateTrustedKeyGroups() *cloudfront.TrustedKeyGroups {
+	cf := c.Status.Providers.CloudFront
+	if c.Distribution.Spec.SignedURLs == nil || cf == nil || cf.KeyGroupId == "" {
+		return &cloudfront.TrustedKeyGroups{
+			Enabled:  aws.Bool(false),
+			Quantity: aws.Int64(0),
+		}
+	}
+
+	return &cloudfront.TrustedKeyGroups{
+		Enabled:  aws.Bool(true),
+		Quantity: aws.Int64(1),
+		Items:    aws.StringSlice([]string{cf.KeyGroupId}),
+	}
+}
+
+// Calculates the Continuous Deployment Policy to attach to the
+// distribution
+//
+// This is only set whilst the Distribution has a rollout configured,
+// and once the RolloutProvider has created the policy.
+func (c *DistributionProvider) calculateContinuousDeploymentPolicyId() string {
+	cf := c.Status.Providers.CloudFront
+	if c.Distribution.Spec.Rollout == nil || cf == nil {
+		return ""
+	}
+
+	return cf.ContinuousDeploymentPolicyId
+}
+
 // Calculates the TTLs to set on the distribution
 //
 // If a Cache Policy Id has been set, this will just return nils. If
@@ -182,35 +308,23 @@ func (c *DistributionProvider) calculateTTLs() (*int64, *int64, *int64) {
 func (c *DistributionProvider) generateDistributionConfig(enabled bool) {
 	supportedMethods, cachedMethods := c.calculateMethods()
 	minTTL, maxTTL, defaultTTL := c.calculateTTLs()
+	origin := c.calculateOrigin()
+
+	// The caller reference cannot be changed, so we must keep whatever
+	// an adopted distribution was created with
+	callerReference := aws.String(string(c.Distribution.UID))
+	if c.CurrentState != nil {
+		callerReference = c.CurrentState.DistributionConfig.CallerReference
+	}
 
 	c.DesiredState = &cloudfront.DistributionConfig{
-		CallerReference: aws.String(string(c.Distribution.UID)),
+		CallerReference: callerReference,
 		Comment:         aws.String("Managed By CDN-Manager"),
 		Enabled:         aws.Bool(enabled),
 		IsIPV6Enabled:   aws.Bool(true),
 		Origins: &cloudfront.Origins{
 			Quantity: aws.Int64(1),
-			Items: []*cloudfront.Origin{&cloudfront.Origin{
-				DomainName:         aws.String(c.Distribution.Spec.Origin.Host),
-				Id:                 aws.String(c.Distribution.Spec.Origin.Host),
-				ConnectionAttempts: aws.Int64(3),
-				ConnectionTimeout:  aws.Int64(10),
-				CustomHeaders: &cloudfront.CustomHeaders{
-					Quantity: aws.Int64(0),
-				},
-				OriginPath: aws.String(""),
-				CustomOriginConfig: &cloudfront.CustomOriginConfig{
-					HTTPPort:               aws.Int64(int64(c.Distribution.Spec.Origin.HTTPPort)),
-					HTTPSPort:              aws.Int64(int64(c.Distribution.Spec.Origin.HTTPSPort)),
-					OriginProtocolPolicy:   aws.String("match-viewer"),
-					OriginReadTimeout:      aws.Int64(30),
-					OriginKeepaliveTimeout: aws.Int64(30),
-					OriginSslProtocols: &cloudfront.OriginSslProtocols{
-						Quantity: aws.Int64(1),
-						Items:    aws.StringSlice([]string{"TLSv1.2"}),
-					},
-				},
-			}},
+			Items:    []*cloudfront.Origin{origin},
 		},
 		CustomErrorResponses: &cloudfront.CustomErrorResponses{
 			Quantity: aws.Int64(0),
@@ -239,8 +353,12 @@ func (c *DistributionProvider) generateDistributionConfig(enabled bool) {
 		DefaultRootObject: aws.String(""),
 		WebACLId:          aws.String(""),
 		HttpVersion:       aws.String("http2"),
+		Staging:           aws.Bool(false),
+		ContinuousDeploymentPolicyId: aws.String(
+			c.calculateContinuousDeploymentPolicyId(),
+		),
 		DefaultCacheBehavior: &cloudfront.DefaultCacheBehavior{
-			TargetOriginId:        aws.String(c.Distribution.Spec.Origin.Host),
+			TargetOriginId:        origin.Id,
 			ViewerProtocolPolicy:  aws.String(c.calculateViewerPolicy()),
 			Compress:              aws.Bool(true),
 			CachePolicyId:         stringOrNil(c.Class.CachePolicyId),
@@ -256,6 +374,7 @@ func (c *DistributionProvider) generateDistributionConfig(enabled bool) {
 				Enabled:  aws.Bool(false),
 				Quantity: aws.Int64(0),
 			},
+			TrustedKeyGroups: c.calculateTrustedKeyGroups(),
 			LambdaFunctionAssociations: &cloudfront.LambdaFunctionAssociations{
 				Quantity: aws.Int64(0),
 			},
@@ -295,12 +414,12 @@ func isAwsError(err error, code string) (bool, awserr.Error) {
 }
 
 func (c *DistributionProvider) load() (*string, error) {
-	res, err := c.Client.GetDistribution(&cloudfront.GetDistributionInput{
+	res, err := c.Client.GetDistributionWithContext(c.Context, &cloudfront.GetDistributionInput{
 		Id: &c.Distribution.Status.ExternalId,
 	})
 
 	if is, _ := isAwsError(err, "NoSuchDistribution"); is {
-		c.Status.ExternalId = ""
+		c.forget()
 		c.Status.ExternalStatus = "Unknown"
 		c.Status.Endpoints = []api.Endpoint{}
 		return nil, nil
@@ -308,15 +427,42 @@ func (c *DistributionProvider) load() (*string, error) {
 		c.Status.ExternalStatus = "Unknown"
 		return nil, err
 	} else {
-		c.CurrentState = res.Distribution
-		c.setStatus()
+		c.checkETag(res.Distribution, res.ETag)
+		c.setState(res.Distribution, res.ETag)
 		return res.ETag, nil
 	}
 }
 
-func (c *DistributionProvider) update(etag *string) (*string, error) {
-	res, err := c.Client.UpdateDistribution(&cloudfront.UpdateDistributionInput{
-		DistributionConfig: c.DesiredState,
+// Reports if the distribution has been changed by something other than
+// the controller since the controller last loaded or changed it
+//
+// Every change to a distribution's config gives it a new ETag, so if it
+// differs from the one we last saw, someone else has made a change.
+func (c *DistributionProvider) checkETag(state *cloudfront.Distribution, etag *string) {
+	known := cloudFrontStatus(c.Status).ETag
+	if known != "" && known != aws.StringValue(etag) {
+		c.Events.Warning(
+			"ModifiedExternally",
+			"CloudFront distribution %v has been changed outside of the controller",
+			*state.Id,
+		)
+	}
+}
+
+// Records the latest state of the distribution, as returned by AWS when
+// it was loaded or changed by the controller
+func (c *DistributionProvider) setState(state *cloudfront.Distribution, etag *string) {
+	c.CurrentState = state
+	c.setStatus()
+	cloudFrontStatus(c.Status).ETag = aws.StringValue(etag)
+}
+
+func (c *DistributionProvider) update(
+	config *cloudfront.DistributionConfig,
+	etag *string,
+) (*string, error) {
+	res, err := c.Client.UpdateDistributionWithContext(c.Context, &cloudfront.UpdateDistributionInput{
+		DistributionConfig: config,
 		Id:                 c.CurrentState.Id,
 		IfMatch:            etag,
 	})
@@ -324,57 +470,265 @@ func (c *DistributionProvider) update(etag *string) (*string, error) {
 	if err != nil {
 		return nil, err
 	} else {
-		c.CurrentState = res.Distribution
-		c.setStatus()
+		c.setState(res.Distribution, res.ETag)
 		return res.ETag, nil
 	}
 }
 
+// Updates the distribution with a config built from its current state
+//
+// Updates are conditional on the distribution not having changed since
+// it was loaded. If it has, it is reloaded and the config rebuilt, so
+// that we never overwrite a change without having seen it first. This is
+// attempted a limited number of times, in case the distribution is being
+// changed repeatedly.
+//
+// If build returns nil, no update is needed.
+func (c *DistributionProvider) updateWithRetry(
+	etag *string,
+	build func() *cloudfront.DistributionConfig,
+) error {
+	for attempt := 1; ; attempt++ {
+		config := build()
+		if config == nil {
+			return nil
+		}
+
+		_, err := c.update(config, etag)
+		if is, _ := isAwsError(err, cloudfront.ErrCodePreconditionFailed); !is || attempt == maxUpdateAttempts {
+			return err
+		}
+
+		if etag, err = c.load(); err != nil {
+			return err
+		} else if etag == nil {
+			return fmt.Errorf("Distribution %v was deleted whilst being updated", *c.CurrentState.Id)
+		}
+	}
+}
+
 func (c *DistributionProvider) Reconcile() error {
 	if c.Distribution.Status.ExternalId != "" {
 		return c.Check()
+	} else if id, _ := c.adoption(); id != "" {
+		return c.Adopt(id)
 	} else {
 		return c.Create()
 	}
 }
 
+// Returns the id of the existing distribution to adopt, and what to do
+// with it, from either the Distribution's spec or its annotations
+func (c *DistributionProvider) adoption() (string, api.AdoptionPolicy) {
+	if adopt := c.Distribution.Spec.Adopt; adopt != nil {
+		if adopt.Policy == "" {
+			return adopt.ExternalId, api.AdoptionConverge
+		}
+		return adopt.ExternalId, adopt.Policy
+	}
+
+	annotations := c.Distribution.Annotations
+	policy := api.AdoptionPolicy(annotations[api.AnnotationAdoptionPolicy])
+	if policy != api.AdoptionObserve {
+		policy = api.AdoptionConverge
+	}
+
+	return annotations[api.AnnotationAdopt], policy
+}
+
+// Checks if the distribution has been adopted with the Observe policy,
+// in which case it must never be changed
+func (c *DistributionProvider) ObserveOnly() bool {
+	id, policy := c.adoption()
+	return id != "" && policy == api.AdoptionObserve
+}
+
+// Takes ownership of an existing distribution, which was not created by
+// the controller
+//
+// From then on, the distribution is checked in exactly the same way as
+// one which was created by the controller.
+func (c *DistributionProvider) Adopt(id string) error {
+	c.Distribution.Status.ExternalId = id
+	etag, err := c.load()
+	if err != nil {
+		return err
+	} else if etag == nil {
+		return fmt.Errorf("Unable to adopt distribution %v: it does not exist", id)
+	}
+
+	c.Events.Normal("Adopted", "Adopted CloudFront distribution %v", id)
+
+	return c.checkLoaded(etag)
+}
+
 // Checks an existing Distribution's state matches with what is expected
 // and updates it if not
 func (c *DistributionProvider) Check() error {
+	id := c.Status.ExternalId
 	etag, err := c.load()
 
 	if err != nil {
 		return err
 	}
 
-	if etag == nil {
+	// Nothing is ever created for a distribution which is only being
+	// observed
+	if etag == nil && c.ObserveOnly() {
+		return fmt.Errorf("Observed distribution %v no longer exists", id)
+	} else if etag == nil {
 		return c.Create()
 	}
 
+	return c.checkLoaded(etag)
+}
+
+// Compares the loaded distribution against its desired state, updating
+// it if required
+func (c *DistributionProvider) checkLoaded(etag *string) error {
 	c.generateDistributionConfig(true)
+	changes := diffConfig(c.DesiredState, c.CurrentState.DistributionConfig)
+	c.Status.PendingChanges = changes
 
-	// We do a DeepEqual comparison to check if the Current State is the
-	// same as the Desired State (and if it is not, this will trigger an
-	// update). When we have multiple hostnames it is important that these
-	// appear in the same order  for the comparison to work.
-	// We always send a sorted list of hostnames, however it looks like
-	// CloudFront returns the list in the order that they were added, so
-	// we need to modify its response and sort them ourselves prior to the
-	// comparison.
-	hosts := make([]string, *c.CurrentState.DistributionConfig.Aliases.Quantity)
-	for idx, element := range c.CurrentState.DistributionConfig.Aliases.Items {
-		hosts[idx] = *element
-	}
-	sort.Strings(hosts)
-	c.CurrentState.DistributionConfig.Aliases.Items = aws.StringSlice(hosts)
+	// Observed distributions only report their differences
+	if c.ObserveOnly() {
+		return nil
+	}
+
+	drifted := c.checkDrift(changes)
+	if drifted && c.DriftPolicy != api.DriftPolicyCorrect {
+		if c.DriftPolicy == api.DriftPolicyIgnore {
+			c.Status.PendingChanges = nil
+		}
+		return nil
+	}
+
+	// Changes are rolled out via a staging distribution if requested
+	if c.Distribution.Spec.Rollout != nil {
+		return NewRolloutProvider(c).Reconcile(etag)
+	}
 
 	// If nothing has changed, we do not need to request an update
-	if reflect.DeepEqual(c.DesiredState, c.CurrentState.DistributionConfig) {
+	if len(changes) == 0 {
 		return nil
 	}
 
-	_, err = c.update(etag)
-	return err
+	// If the distribution is changed whilst we are updating it, the
+	// changes are worked out again
+	err := c.updateWithRetry(etag, func() *cloudfront.DistributionConfig {
+		c.generateDistributionConfig(true)
+		if changes = diffConfig(c.DesiredState, c.CurrentState.DistributionConfig); len(changes) == 0 {
+			return nil
+		}
+		return c.DesiredState
+	})
+	if err != nil {
+		return err
+	}
+
+	if drifted {
+		metrics.DriftCorrections.WithLabelValues("cloudfront").Inc()
+		c.Events.Normal(
+			"DriftCorrected",
+			"Reverted changes made outside of the controller to CloudFront distribution %v: %v",
+			*c.CurrentState.Id,
+			summariseChanges(changes),
+		)
+	} else {
+		c.Events.Normal(
+			"Updated",
+			"Updated CloudFront distribution %v: %v",
+			*c.CurrentState.Id,
+			summariseChanges(changes),
+		)
+	}
+
+	c.Status.PendingChanges = nil
+	c.Status.Drift = nil
+	return nil
+}
+
+// Works out whether the differences between the external distribution
+// and its desired state are due to changes made outside of the
+// controller
+//
+// This is the case if the desired state is the same as it was when the
+// distribution was last seen to match it. Any drifted fields are
+// recorded in the status, and reported in an event when they are first
+// noticed.
+func (c *DistributionProvider) checkDrift(changes []string) bool {
+	cf := cloudFrontStatus(c.Status)
+	hash := configHash(c.DesiredState)
+
+	if len(changes) == 0 {
+		cf.AppliedConfigHash = hash
+		c.Status.Drift = nil
+		return false
+	}
+
+	// The Distribution (or something it depends on) has changed since
+	// the distribution last matched, so this is a normal update
+	if cf.AppliedConfigHash != hash {
+		c.Status.Drift = nil
+		return false
+	}
+
+	if !reflect.DeepEqual(c.Status.Drift, changes) && c.DriftPolicy != api.DriftPolicyIgnore {
+		c.Events.Warning(
+			"DriftDetected",
+			"CloudFront distribution %v has been changed outside of the controller: %v",
+			*c.CurrentState.Id,
+			summariseChanges(changes),
+		)
+	}
+
+	c.Status.Drift = changes
+	return true
+}
+
+// Works out the changes that Reconcile would make to the distribution,
+// without making them
+func (c *DistributionProvider) Plan() ([]string, error) {
+	var plan []string
+	if c.Distribution.Status.ExternalId == "" {
+		id, _ := c.adoption()
+		if id == "" {
+			return []string{"Create CloudFront distribution"}, nil
+		}
+
+		plan = append(plan, "Adopt CloudFront distribution "+id)
+		c.Distribution.Status.ExternalId = id
+
+		// The distribution has not actually been adopted, so its state
+		// is loaded into a copy of the status, which is thrown away
+		status := c.Status
+		c.Status = status.DeepCopy()
+		defer func() { c.Status = status }()
+	}
+
+	etag, err := c.load()
+	if err != nil {
+		return nil, err
+	} else if etag == nil && c.ObserveOnly() {
+		return nil, fmt.Errorf("Observed distribution %v does not exist", c.Distribution.Status.ExternalId)
+	} else if etag == nil {
+		return append(plan, "Create CloudFront distribution"), nil
+	}
+
+	c.generateDistributionConfig(true)
+	changes := diffConfigChanges(c.DesiredState, c.CurrentState.DistributionConfig)
+	c.Status.PendingChanges = nil
+	for _, change := range changes {
+		c.Status.PendingChanges = append(c.Status.PendingChanges, change.Path)
+		plan = append(plan, "Update "+change.String())
+	}
+
+	// Observed distributions are never changed
+	if c.ObserveOnly() {
+		return nil, nil
+	}
+
+	return plan, nil
 }
 
 // Creates a CloudFront Distribution and sets its status on the
@@ -388,7 +742,7 @@ func (c *DistributionProvider) Check() error {
 //   Distribution has been destroyed).
 func (c *DistributionProvider) Create() error {
 	c.generateDistributionConfig(true)
-	current, err := c.Client.CreateDistribution(&cloudfront.CreateDistributionInput{
+	current, err := c.Client.CreateDistributionWithContext(c.Context, &cloudfront.CreateDistributionInput{
 		DistributionConfig: c.DesiredState,
 	})
 
@@ -412,13 +766,22 @@ func (c *DistributionProvider) Create() error {
 		return err
 	}
 
-	c.CurrentState = current.Distribution
-	c.setStatus()
+	c.setState(current.Distribution, current.ETag)
+	c.Events.Normal("Created", "Created CloudFront distribution %v", *c.CurrentState.Id)
 
 	return nil
 }
 
 func (c *DistributionProvider) Delete() error {
+	// Observed distributions are left exactly as they are, we just stop
+	// tracking them
+	if c.ObserveOnly() {
+		c.forget()
+		c.Status.Endpoints = []api.Endpoint{}
+		c.Status.PendingChanges = nil
+		return nil
+	}
+
 	etag, err := c.load()
 	if err != nil {
 		return err
@@ -428,11 +791,24 @@ func (c *DistributionProvider) Delete() error {
 	}
 
 	if *c.CurrentState.DistributionConfig.Enabled {
-		// Bit of a nasty hack
-		c.DesiredState = c.CurrentState.DistributionConfig
-		c.DesiredState.SetEnabled(false)
-		_, err = c.update(etag)
-		return err
+		err = c.updateWithRetry(etag, func() *cloudfront.DistributionConfig {
+			config := c.CurrentState.DistributionConfig
+			if !*config.Enabled {
+				return nil
+			}
+
+			config.SetEnabled(false)
+			// The Continuous Deployment Policy must be detached so that it
+			// can be deleted
+			config.SetContinuousDeploymentPolicyId("")
+			return config
+		})
+		if err != nil {
+			return err
+		}
+
+		c.Events.Normal("Disabling", "Disabling CloudFront distribution %v before deletion", *c.CurrentState.Id)
+		return nil
 	}
 
 	// We have to wait until the distribution is completely disabled
@@ -443,7 +819,7 @@ func (c *DistributionProvider) Delete() error {
 
 	// We ignore the DeleteDistributionOutput because it doesn't contain
 	// anything
-	_, err = c.Client.DeleteDistribution(&cloudfront.DeleteDistributionInput{
+	_, err = c.Client.DeleteDistributionWithContext(c.Context, &cloudfront.DeleteDistributionInput{
 		Id:      c.CurrentState.Id,
 		IfMatch: etag,
 	})
@@ -451,13 +827,58 @@ func (c *DistributionProvider) Delete() error {
 	if err != nil {
 		return err
 	} else {
-		c.Status.ExternalId = ""
+		c.Events.Normal("Deleted", "Deleted CloudFront distribution %v", *c.CurrentState.Id)
+		c.forget()
 		c.Status.Endpoints = []api.Endpoint{}
 
 		return nil
 	}
 }
 
+// Clears the state held about the external distribution, once it no
+// longer exists or is no longer being tracked
+func (c *DistributionProvider) forget() {
+	c.Status.ExternalId = ""
+	c.Status.Drift = nil
+	cloudFrontStatus(c.Status).AppliedConfigHash = ""
+	cloudFrontStatus(c.Status).ETag = ""
+}
+
+// Disables the distribution, but leaves it in place
+//
+// We do not need to wait for the change to be deployed, as nothing else
+// is going to happen to the distribution afterwards.
+func (c *DistributionProvider) Disable() error {
+	if c.ObserveOnly() || c.Status.ExternalId == "" {
+		return nil
+	}
+
+	etag, err := c.load()
+	if err != nil || etag == nil {
+		return err
+	}
+
+	if !*c.CurrentState.DistributionConfig.Enabled {
+		return nil
+	}
+
+	err = c.updateWithRetry(etag, func() *cloudfront.DistributionConfig {
+		config := c.CurrentState.DistributionConfig
+		if !*config.Enabled {
+			return nil
+		}
+
+		config.SetEnabled(false)
+		return config
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Events.Normal("Disabling", "Disabling CloudFront distribution %v", *c.CurrentState.Id)
+	return nil
+}
+
 // stringOrNil checks to see if a string has any value - if it does, it
 // returns a pointer to the string. If it doesn't (ie it is an empty
 // string), it returns nil.
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
+	"gitlab.com/redcoat/cdn-manager/pkg/provider"
+)
+
+// The classes of the AWS error codes which the controller handles
+// differently from other errors
+var errorClasses = map[string]provider.ErrorClass{
+	"Throttling":               provider.ErrorThrottled,
+	"ThrottlingException":      provider.ErrorThrottled,
+	"TooManyRequestsException": provider.ErrorThrottled,
+	"RequestLimitExceeded":     provider.ErrorThrottled,
+	"SlowDown":                 provider.ErrorThrottled,
+
+	"PreconditionFailed":    provider.ErrorConflict,
+	"InvalidIfMatchVersion": provider.ErrorConflict,
+	"OperationAborted":      provider.ErrorConflict,
+
+	"TooManyDistributions":                provider.ErrorQuotaExceeded,
+	"TooManyDistributionCNAMEs":           provider.ErrorQuotaExceeded,
+	"TooManyCertificates":                 provider.ErrorQuotaExceeded,
+	"TooManyContinuousDeploymentPolicies": provider.ErrorQuotaExceeded,
+	"TooManyKeyGroups":                    provider.ErrorQuotaExceeded,
+	"TooManyOriginAccessControls":         provider.ErrorQuotaExceeded,
+	"TooManyPublicKeys":                   provider.ErrorQuotaExceeded,
+	"TooManyPublicKeysInKeyGroup":         provider.ErrorQuotaExceeded,
+	"LimitExceededException":              provider.ErrorQuotaExceeded,
+
+	"InvalidViewerCertificate":  provider.ErrorInvalidConfig,
+	"InvalidArgument":           provider.ErrorInvalidConfig,
+	"InvalidOrigin":             provider.ErrorInvalidConfig,
+	"CNAMEAlreadyExists":        provider.ErrorInvalidConfig,
+	"IllegalUpdate":             provider.ErrorInvalidConfig,
+	"ValidationException":       provider.ErrorInvalidConfig,
+	"InvalidParameterException": provider.ErrorInvalidConfig,
+}
+
+// Wraps an AWS error with its class, so that the controller can decide
+// how long to wait before retrying
+//
+// This is intended to be deferred with a pointer to a named error
+// return value.
+func classifyError(err *error) {
+	var awsErr awserr.Error
+	if *err == nil || !errors.As(*err, &awsErr) {
+		return
+	}
+
+	if class, ok := errorClasses[awsErr.Code()]; ok {
+		*err = provider.ClassifiedError{Class: class, Err: *err}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// The maximum number of changed fields listed in an event
+const maxEventChanges = 10
+
+// Records Kubernetes Events against the Distribution being reconciled
+//
+// If no Recorder is set, events are silently dropped.
+type Events struct {
+	Recorder record.EventRecorder
+	Object   runtime.Object
+}
+
+// Records a Normal event
+func (e Events) Normal(reason, messageFmt string, args ...interface{}) {
+	e.record(corev1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+// Records a Warning event
+func (e Events) Warning(reason, messageFmt string, args ...interface{}) {
+	e.record(corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+func (e Events) record(eventType, reason, messageFmt string, args ...interface{}) {
+	if e.Recorder == nil || e.Object == nil {
+		return
+	}
+
+	e.Recorder.Eventf(e.Object, eventType, reason, messageFmt, args...)
+}
+
+// Summarises a list of changed fields for use in an event message
+func summariseChanges(changes []string) string {
+	if len(changes) <= maxEventChanges {
+		return strings.Join(changes, ", ")
+	}
+
+	return fmt.Sprintf(
+		"%v and %v more",
+		strings.Join(changes[:maxEventChanges], ", "),
+		len(changes)-maxEventChanges,
+	)
+}
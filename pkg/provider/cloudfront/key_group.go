@@ -0,0 +1,444 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
+)
+
+// The default time that a previous signing key is trusted for after a
+// new one has been uploaded
+const defaultRotationGracePeriod = time.Hour
+
+// The most Public Keys CloudFront allows in a single Key Group
+const maxKeyGroupKeys = 5
+
+// The KeyGroupProvider uploads a Distribution's signing key as a
+// CloudFront Public Key, and manages the Key Group which the
+// distribution trusts to sign URLs
+//
+// Keys are rotated by adding the new Public Key to the Key Group
+// alongside the old one, and only removing the old one once the
+// rotation grace period has passed, so that URLs signed with the old
+// key remain valid whilst applications switch over.
+type KeyGroupProvider struct {
+	Context      context.Context
+	Client       *cloudfront.CloudFront
+	Distribution api.Distribution
+	Status       *api.DistributionStatus
+	Key          *resolver.SigningKey
+	Events       Events
+}
+
+// Sets up a new instance of the KeyGroupProvider
+func NewKeyGroupProvider(
+	ctx context.Context,
+	cfg client.ConfigProvider,
+	distro api.Distribution,
+	status *api.DistributionStatus,
+	key *resolver.SigningKey,
+	events Events,
+) *KeyGroupProvider {
+	return &KeyGroupProvider{
+		Context:      ctx,
+		Client:       cloudfront.New(cfg),
+		Distribution: distro,
+		Status:       status,
+		Key:          key,
+		Events:       events,
+	}
+}
+
+// The name given to the Key Group in CloudFront
+func (c *KeyGroupProvider) name() string {
+	return string(c.Distribution.UID)
+}
+
+// The name given to a Public Key in CloudFront
+//
+// Public Key names must be unique, so this includes part of the key's
+// fingerprint.
+func (c *KeyGroupProvider) keyName(fingerprint string) string {
+	return string(c.Distribution.UID) + "-" + fingerprint[:16]
+}
+
+// Returns the grace period during which a rotated key is still trusted
+func (c *KeyGroupProvider) gracePeriod() time.Duration {
+	spec := c.Distribution.Spec.SignedURLs
+	if spec == nil || spec.RotationGracePeriod == nil {
+		return defaultRotationGracePeriod
+	}
+
+	return spec.RotationGracePeriod.Duration
+}
+
+// Ensures that the current signing key has been uploaded and is in the
+// Distribution's Key Group
+//
+// If the Distribution does not require signed URLs, nothing is done
+// here - any existing Key Group may still be in use by the CloudFront
+// distribution until it has been updated, so it is left to Cleanup().
+func (c *KeyGroupProvider) Reconcile() error {
+	if c.Distribution.Spec.SignedURLs == nil || c.Key == nil {
+		return nil
+	}
+
+	status := cloudFrontStatus(c.Status)
+	if current := c.newestKey(); current == nil || current.Fingerprint != c.Key.Fingerprint {
+		if err := c.addKey(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.dropExcessKeys(); err != nil {
+		return err
+	}
+
+	if err := c.reconcileKeyGroup(c.keyIds()); err != nil {
+		return err
+	}
+
+	c.Status.SigningKeyId = status.PublicKeys[len(status.PublicKeys)-1].Id
+	return nil
+}
+
+// Returns the most recently uploaded Public Key
+func (c *KeyGroupProvider) newestKey() *cfapi.PublicKeyStatus {
+	keys := cloudFrontStatus(c.Status).PublicKeys
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return &keys[len(keys)-1]
+}
+
+// Returns the Ids of all of the uploaded Public Keys
+func (c *KeyGroupProvider) keyIds() []string {
+	keys := cloudFrontStatus(c.Status).PublicKeys
+	ids := make([]string, len(keys))
+	for idx, key := range keys {
+		ids[idx] = key.Id
+	}
+
+	return ids
+}
+
+// Uploads the current signing key as the newest Public Key
+//
+// If the key has been used before (ie the secret was rolled back) and
+// has not yet been removed, it is moved to be the newest key rather
+// than uploaded again.
+func (c *KeyGroupProvider) addKey() error {
+	status := cloudFrontStatus(c.Status)
+	for idx, key := range status.PublicKeys {
+		if key.Fingerprint == c.Key.Fingerprint {
+			status.PublicKeys = append(status.PublicKeys[:idx], status.PublicKeys[idx+1:]...)
+			key.CreatedAt = metav1.Now()
+			status.PublicKeys = append(status.PublicKeys, key)
+			return nil
+		}
+	}
+
+	name := c.keyName(c.Key.Fingerprint)
+	res, err := c.Client.CreatePublicKeyWithContext(c.Context, &cloudfront.CreatePublicKeyInput{
+		PublicKeyConfig: &cloudfront.PublicKeyConfig{
+			CallerReference: aws.String(name),
+			Name:            aws.String(name),
+			Comment:         aws.String("Managed By CDN-Manager"),
+			EncodedKey:      aws.String(string(c.Key.PublicKey)),
+		},
+	})
+
+	var id string
+	if is, _ := isAwsError(err, cloudfront.ErrCodePublicKeyAlreadyExists); is {
+		// As with Distributions, this is very likely to be ours with the
+		// status having been lost, so we'll go and find it.
+		if id, err = c.findKey(name); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		id = *res.PublicKey.Id
+	}
+
+	status.PublicKeys = append(status.PublicKeys, cfapi.PublicKeyStatus{
+		Id:          id,
+		Fingerprint: c.Key.Fingerprint,
+		CreatedAt:   metav1.Now(),
+	})
+
+	return nil
+}
+
+// Removes the oldest Public Keys, even if they are still in their
+// rotation grace period, if there are more than CloudFront allows in a
+// Key Group
+//
+// This only happens if the key is rotated several times within the
+// grace period. Otherwise, the Key Group could not be updated until
+// the grace period had passed.
+func (c *KeyGroupProvider) dropExcessKeys() error {
+	status := cloudFrontStatus(c.Status)
+	excess := len(status.PublicKeys) - maxKeyGroupKeys
+	if excess <= 0 {
+		return nil
+	}
+
+	// The keys must no longer be trusted before they can be deleted
+	if err := c.reconcileKeyGroup(c.keyIds()[excess:]); err != nil {
+		return err
+	}
+
+	for ; excess > 0; excess-- {
+		key := status.PublicKeys[0]
+		c.Events.Warning(
+			"SigningKeyDropped",
+			"Stopped trusting public key %v before the end of its rotation grace period, as a key group can only have %v keys",
+			key.Id,
+			maxKeyGroupKeys,
+		)
+
+		if err := c.deleteKey(key.Id); err != nil {
+			return err
+		}
+		status.PublicKeys = status.PublicKeys[1:]
+	}
+
+	return nil
+}
+
+// Searches for an existing Public Key by name
+func (c *KeyGroupProvider) findKey(name string) (string, error) {
+	input := &cloudfront.ListPublicKeysInput{}
+	for {
+		res, err := c.Client.ListPublicKeysWithContext(c.Context, input)
+		if err != nil {
+			return "", err
+		}
+
+		for _, item := range res.PublicKeyList.Items {
+			if *item.Name == name {
+				return *item.Id, nil
+			}
+		}
+
+		if res.PublicKeyList.NextMarker == nil || *res.PublicKeyList.NextMarker == "" {
+			return "", fmt.Errorf("Could not find the existing public key \"%v\"", name)
+		}
+		input.Marker = res.PublicKeyList.NextMarker
+	}
+}
+
+// Searches for an existing Key Group by name
+func (c *KeyGroupProvider) findKeyGroup() (string, error) {
+	input := &cloudfront.ListKeyGroupsInput{}
+	for {
+		res, err := c.Client.ListKeyGroupsWithContext(c.Context, input)
+		if err != nil {
+			return "", err
+		}
+
+		for _, item := range res.KeyGroupList.Items {
+			if *item.KeyGroup.KeyGroupConfig.Name == c.name() {
+				return *item.KeyGroup.Id, nil
+			}
+		}
+
+		if res.KeyGroupList.NextMarker == nil || *res.KeyGroupList.NextMarker == "" {
+			return "", fmt.Errorf("Could not find the existing key group \"%v\"", c.name())
+		}
+		input.Marker = res.KeyGroupList.NextMarker
+	}
+}
+
+// Ensures that the Key Group exists and contains exactly the given
+// Public Keys
+func (c *KeyGroupProvider) reconcileKeyGroup(ids []string) error {
+	status := cloudFrontStatus(c.Status)
+	config := &cloudfront.KeyGroupConfig{
+		Name:    aws.String(c.name()),
+		Comment: aws.String("Managed By CDN-Manager"),
+		Items:   aws.StringSlice(ids),
+	}
+
+	if status.KeyGroupId != "" {
+		res, err := c.Client.GetKeyGroupWithContext(c.Context, &cloudfront.GetKeyGroupInput{
+			Id: aws.String(status.KeyGroupId),
+		})
+
+		if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchResource); is {
+			status.KeyGroupId = ""
+		} else if err != nil {
+			return err
+		} else {
+			current := aws.StringValueSlice(res.KeyGroup.KeyGroupConfig.Items)
+			sort.Strings(current)
+			desired := append([]string{}, ids...)
+			sort.Strings(desired)
+			if reflect.DeepEqual(current, desired) {
+				return nil
+			}
+
+			_, err = c.Client.UpdateKeyGroupWithContext(c.Context, &cloudfront.UpdateKeyGroupInput{
+				Id:             res.KeyGroup.Id,
+				IfMatch:        res.ETag,
+				KeyGroupConfig: config,
+			})
+			return err
+		}
+	}
+
+	res, err := c.Client.CreateKeyGroupWithContext(c.Context, &cloudfront.CreateKeyGroupInput{
+		KeyGroupConfig: config,
+	})
+
+	if is, _ := isAwsError(err, cloudfront.ErrCodeKeyGroupAlreadyExists); is {
+		id, err := c.findKeyGroup()
+		if err != nil {
+			return err
+		}
+		status.KeyGroupId = id
+		return c.reconcileKeyGroup(ids)
+	} else if err != nil {
+		return err
+	}
+
+	status.KeyGroupId = *res.KeyGroup.Id
+	return nil
+}
+
+// Removes Public Keys which have been replaced, once the newest key has
+// been in place for the rotation grace period
+//
+// Whilst a rotation is still in its grace period, the Distribution is
+// marked as not Ready, so that it is rechecked.
+func (c *KeyGroupProvider) Expire() error {
+	status := cloudFrontStatus(c.Status)
+	if c.Distribution.Spec.SignedURLs == nil || len(status.PublicKeys) < 2 {
+		return nil
+	}
+
+	newest := *c.newestKey()
+	if time.Since(newest.CreatedAt.Time) < c.gracePeriod() {
+		c.Status.Ready = false
+		return nil
+	}
+
+	if err := c.reconcileKeyGroup([]string{newest.Id}); err != nil {
+		return err
+	}
+
+	for len(status.PublicKeys) > 1 {
+		if err := c.deleteKey(status.PublicKeys[0].Id); err != nil {
+			return err
+		}
+		status.PublicKeys = status.PublicKeys[1:]
+	}
+
+	return nil
+}
+
+// Removes the Key Group and Public Keys if the Distribution no longer
+// requires signed URLs
+func (c *KeyGroupProvider) Cleanup() error {
+	if c.Distribution.Spec.SignedURLs != nil {
+		return nil
+	}
+
+	return c.Delete()
+}
+
+// Deletes the Key Group and all of the Public Keys
+//
+// CloudFront will refuse to do this whilst the Key Group is still
+// trusted by a distribution, so this must only be called once the
+// distribution has been updated or deleted.
+func (c *KeyGroupProvider) Delete() error {
+	status := cloudFrontStatus(c.Status)
+	defer tidyCloudFrontStatus(c.Status)
+
+	if status.KeyGroupId != "" {
+		res, err := c.Client.GetKeyGroupWithContext(c.Context, &cloudfront.GetKeyGroupInput{
+			Id: aws.String(status.KeyGroupId),
+		})
+
+		if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchResource); !is {
+			if err != nil {
+				return err
+			}
+
+			_, err = c.Client.DeleteKeyGroupWithContext(c.Context, &cloudfront.DeleteKeyGroupInput{
+				Id:      res.KeyGroup.Id,
+				IfMatch: res.ETag,
+			})
+			if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchResource); !is && err != nil {
+				return err
+			}
+		}
+
+		status.KeyGroupId = ""
+	}
+
+	for len(status.PublicKeys) > 0 {
+		if err := c.deleteKey(status.PublicKeys[0].Id); err != nil {
+			return err
+		}
+		status.PublicKeys = status.PublicKeys[1:]
+	}
+
+	status.PublicKeys = nil
+	c.Status.SigningKeyId = ""
+	return nil
+}
+
+// Deletes the given Public Key, ignoring it if it has already gone
+func (c *KeyGroupProvider) deleteKey(id string) error {
+	res, err := c.Client.GetPublicKeyWithContext(c.Context, &cloudfront.GetPublicKeyInput{
+		Id: aws.String(id),
+	})
+
+	if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchPublicKey); is {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = c.Client.DeletePublicKeyWithContext(c.Context, &cloudfront.DeletePublicKeyInput{
+		Id:      aws.String(id),
+		IfMatch: res.ETag,
+	})
+
+	if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchPublicKey); is {
+		return nil
+	}
+
+	return err
+}
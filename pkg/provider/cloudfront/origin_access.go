@@ -0,0 +1,193 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// The OriginAccessProvider manages the Origin Access Control which
+// CloudFront uses to sign its requests to S3 bucket origins
+type OriginAccessProvider struct {
+	Context      context.Context
+	Client       *cloudfront.CloudFront
+	Distribution api.Distribution
+	Status       *api.DistributionStatus
+}
+
+// Sets up a new instance of the OriginAccessProvider
+func NewOriginAccessProvider(
+	ctx context.Context,
+	cfg client.ConfigProvider,
+	distro api.Distribution,
+	status *api.DistributionStatus,
+) *OriginAccessProvider {
+	return &OriginAccessProvider{
+		Context:      ctx,
+		Client:       cloudfront.New(cfg),
+		Distribution: distro,
+		Status:       status,
+	}
+}
+
+// The name given to the Origin Access Control in CloudFront
+//
+// Like the Distribution's CallerReference, this is the k8s resource
+// UID, so that we can find it again if the status is lost.
+func (c *OriginAccessProvider) name() string {
+	return string(c.Distribution.UID)
+}
+
+// Ensures an Origin Access Control exists if the Distribution has an
+// S3 origin
+//
+// If the Distribution does not have an S3 origin, no Origin Access
+// Control is required. This does not remove any existing one, as it
+// may still be in use by the CloudFront distribution until it has been
+// updated - that is left to Cleanup().
+func (c *OriginAccessProvider) Reconcile() error {
+	if c.Distribution.Spec.Origin.S3 == nil {
+		return nil
+	}
+
+	if cloudFrontStatus(c.Status).OriginAccessControlId != "" {
+		return c.Check()
+	} else {
+		return c.Create()
+	}
+}
+
+// Checks that the Origin Access Control still exists, recreating it if
+// not
+func (c *OriginAccessProvider) Check() error {
+	_, err := c.Client.GetOriginAccessControlWithContext(c.Context, &cloudfront.GetOriginAccessControlInput{
+		Id: aws.String(cloudFrontStatus(c.Status).OriginAccessControlId),
+	})
+
+	if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchOriginAccessControl); is {
+		cloudFrontStatus(c.Status).OriginAccessControlId = ""
+		return c.Create()
+	}
+
+	return err
+}
+
+// Creates an Origin Access Control for the Distribution's S3 origin
+func (c *OriginAccessProvider) Create() error {
+	res, err := c.Client.CreateOriginAccessControlWithContext(c.Context, &cloudfront.CreateOriginAccessControlInput{
+		OriginAccessControlConfig: &cloudfront.OriginAccessControlConfig{
+			Name:                          aws.String(c.name()),
+			Description:                   aws.String("Managed By CDN-Manager"),
+			OriginAccessControlOriginType: aws.String(cloudfront.OriginAccessControlOriginTypesS3),
+			SigningBehavior:               aws.String(cloudfront.OriginAccessControlSigningBehaviorsAlways),
+			SigningProtocol:               aws.String(cloudfront.OriginAccessControlSigningProtocolsSigv4),
+		},
+	})
+
+	// As with Distributions, an existing Origin Access Control with our
+	// name is very likely to be ours, with the status having been lost,
+	// so we'll go and find it.
+	if is, _ := isAwsError(err, cloudfront.ErrCodeOriginAccessControlAlreadyExists); is {
+		return c.find()
+	} else if err != nil {
+		return err
+	}
+
+	cloudFrontStatus(c.Status).OriginAccessControlId = *res.OriginAccessControl.Id
+	return nil
+}
+
+// Searches for an existing Origin Access Control by name and sets its
+// Id in the status
+func (c *OriginAccessProvider) find() error {
+	input := &cloudfront.ListOriginAccessControlsInput{}
+	for {
+		res, err := c.Client.ListOriginAccessControlsWithContext(c.Context, input)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range res.OriginAccessControlList.Items {
+			if *item.Name == c.name() {
+				cloudFrontStatus(c.Status).OriginAccessControlId = *item.Id
+				return nil
+			}
+		}
+
+		if !*res.OriginAccessControlList.IsTruncated {
+			return fmt.Errorf("Could not find the existing origin access control \"%v\"", c.name())
+		}
+		input.Marker = res.OriginAccessControlList.NextMarker
+	}
+}
+
+// Removes the Origin Access Control if the Distribution no longer has
+// an S3 origin
+func (c *OriginAccessProvider) Cleanup() error {
+	if c.Distribution.Spec.Origin.S3 != nil {
+		return nil
+	}
+
+	return c.Delete()
+}
+
+// Deletes the Origin Access Control, if one exists
+//
+// CloudFront will refuse to do this whilst the Origin Access Control is
+// still attached to a distribution, so this must only be called once
+// the distribution has been updated or deleted.
+func (c *OriginAccessProvider) Delete() error {
+	status := cloudFrontStatus(c.Status)
+	defer tidyCloudFrontStatus(c.Status)
+
+	if status.OriginAccessControlId == "" {
+		return nil
+	}
+
+	res, err := c.Client.GetOriginAccessControlWithContext(c.Context, &cloudfront.GetOriginAccessControlInput{
+		Id: aws.String(status.OriginAccessControlId),
+	})
+
+	if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchOriginAccessControl); is {
+		status.OriginAccessControlId = ""
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = c.Client.DeleteOriginAccessControlWithContext(c.Context, &cloudfront.DeleteOriginAccessControlInput{
+		Id:      res.OriginAccessControl.Id,
+		IfMatch: res.ETag,
+	})
+
+	if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchOriginAccessControl); is {
+		status.OriginAccessControlId = ""
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	status.OriginAccessControlId = ""
+	return nil
+}
@@ -17,28 +17,83 @@ limitations under the License.
 package cloudfront
 
 import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1rest "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
 	"gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/auth"
 	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
+	"gitlab.com/redcoat/cdn-manager/pkg/tracing"
+	"gitlab.com/redcoat/cdn-manager/pkg/util"
 )
 
 type CloudFrontProvider struct {
 	Auth *auth.AwsAuthProvider
+
+	// Used to record events against the Distributions being reconciled
+	Recorder record.EventRecorder
 }
 
-func New(corev1 corev1rest.CoreV1Interface) (*CloudFrontProvider, error) {
-	auth, err := auth.NewAwsAuthProvider("cdn-manager", &corev1)
+func New(
+	corev1 corev1rest.CoreV1Interface,
+	recorder record.EventRecorder,
+	limit auth.RateLimit,
+) (*CloudFrontProvider, error) {
+	auth, err := auth.NewAwsAuthProvider("cdn-manager", &corev1, limit)
 	if err != nil {
 		return nil, err
 	}
 
 	return &CloudFrontProvider{
-		Auth: auth,
+		Auth:     auth,
+		Recorder: recorder,
 	}, nil
 }
 
+// Starts a span for an operation on the given Distribution
+//
+// The external id is added when the span ends, as it may not be known
+// until the distribution has been created.
+func (p CloudFrontProvider) startSpan(
+	ctx context.Context,
+	name string,
+	distro api.Distribution,
+	status *api.DistributionStatus,
+) (context.Context, trace.Span) {
+	ctx, span := tracing.Start(
+		ctx,
+		name,
+		tracing.AttributeProvider.String("cloudfront"),
+		tracing.AttributeDistribution.String(distro.Namespace+"/"+distro.Name),
+		tracing.AttributeClass.String(distro.Spec.DistributionClassRef.Name),
+	)
+
+	return ctx, externalIdSpan{Span: span, status: status}
+}
+
+// Wraps a span so that the distribution's external id is recorded on it
+// when it ends
+type externalIdSpan struct {
+	trace.Span
+	status *api.DistributionStatus
+}
+
+func (s externalIdSpan) End(options ...trace.SpanEndOption) {
+	s.SetAttributes(tracing.AttributeExternalId.String(s.status.ExternalId))
+	s.Span.End(options...)
+}
+
+// Returns an Events recorder for the given Distribution
+func (p CloudFrontProvider) events(distro *api.Distribution) Events {
+	return Events{Recorder: p.Recorder, Object: distro}
+}
+
 func (p CloudFrontProvider) Wants(class api.DistributionClassSpec) bool {
 	return class.Providers.CloudFront != nil
 }
@@ -46,41 +101,206 @@ func (p CloudFrontProvider) Wants(class api.DistributionClassSpec) bool {
 // Creates a new CloudFront Provider from the given Distribution and
 // calculated ResolvedOrigin
 func (p CloudFrontProvider) Reconcile(
+	ctx context.Context,
+	class api.DistributionClassSpec,
+	distro api.Distribution,
+	cert *resolver.Certificate,
+	key *resolver.SigningKey,
+	status *api.DistributionStatus,
+) (err error) {
+	ctx, span := p.startSpan(ctx, "CloudFront.Reconcile", distro, status)
+	defer tracing.End(span, &err)
+	defer classifyError(&err)
+
+	sess, _ := p.Auth.NewSession(ctx, class.Providers.CloudFront.Auth, nil)
+	defer tidyCloudFrontStatus(status)
+	status.Plan = nil
+	status.NextMaintenanceWindow = nil
+
+	// Observed distributions are never changed, so there is no need to
+	// set up any of their supporting resources
+	distribution := NewDistributionProvider(ctx, sess, class, distro, status, p.events(&distro))
+	if distribution.ObserveOnly() {
+		return distribution.Reconcile()
+	}
+
+	err = NewCertificateProvider(ctx, sess, status, cert, p.events(&distro)).Reconcile()
+	if err != nil {
+		return err
+	}
+
+	// Outside of the class's maintenance window, only the certificate is
+	// kept up to date (in case it is about to expire) and any other
+	// changes to an existing distribution wait for the window to open
+	if status.ExternalId != "" {
+		open, next, err := util.MaintenanceWindowOpen(class.MaintenanceWindow, time.Now())
+		if err != nil {
+			return fmt.Errorf("Invalid maintenance window: %w", err)
+		} else if !open {
+			return deferChanges(distribution, next)
+		}
+	}
+
+	access := NewOriginAccessProvider(ctx, sess, distro, status)
+	if err := access.Reconcile(); err != nil {
+		return err
+	}
+
+	keyGroup := NewKeyGroupProvider(ctx, sess, distro, status, key, p.events(&distro))
+	if err := keyGroup.Reconcile(); err != nil {
+		return err
+	}
+
+	if err := distribution.Reconcile(); err != nil {
+		return err
+	}
+
+	// The bucket policy grants access to the distribution's ARN, so we
+	// can only do this once the distribution exists
+	if state := distribution.CurrentState; state != nil {
+		err := NewBucketPolicyProvider(ctx, sess, distro, status).Reconcile(*state.ARN)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := NewRolloutProvider(distribution).Cleanup(); err != nil {
+		return err
+	}
+
+	if err := keyGroup.Expire(); err != nil {
+		return err
+	}
+
+	// Whilst a rollout is in progress, the primary distribution may
+	// still be using resources that the staging distribution no longer
+	// needs, so these are left in place until it has completed
+	if status.Rollout != nil {
+		return nil
+	}
+
+	if err := keyGroup.Cleanup(); err != nil {
+		return err
+	}
+
+	return access.Cleanup()
+}
+
+// Refreshes the distribution's status and lists the changes it needs
+// in status.pendingChanges, without applying them
+func deferChanges(distribution *DistributionProvider, until time.Time) error {
+	changes, err := distribution.Plan()
+	if err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		distribution.Status.NextMaintenanceWindow = &metav1.Time{Time: until}
+	}
+
+	return nil
+}
+
+func (p CloudFrontProvider) Plan(
+	ctx context.Context,
 	class api.DistributionClassSpec,
 	distro api.Distribution,
 	cert *resolver.Certificate,
+	key *resolver.SigningKey,
 	status *api.DistributionStatus,
-) error {
-	sess, _ := p.Auth.NewSession(class.Providers.CloudFront.Auth, nil)
+) (err error) {
+	ctx, span := p.startSpan(ctx, "CloudFront.Plan", distro, status)
+	defer tracing.End(span, &err)
+	defer classifyError(&err)
+
+	sess, _ := p.Auth.NewSession(ctx, class.Providers.CloudFront.Auth, nil)
+	defer tidyCloudFrontStatus(status)
+
+	var plan []string
+	if cert != nil {
+		certPlan, err := NewCertificateProvider(ctx, sess, status, cert, p.events(&distro)).Plan()
+		if err != nil {
+			return err
+		}
+		plan = append(plan, certPlan...)
+	}
 
-	err := NewCertificateProvider(sess, status, cert).Reconcile()
+	distroPlan, err := NewDistributionProvider(ctx, sess, class, distro, status, p.events(&distro)).Plan()
 	if err != nil {
 		return err
 	}
 
-	return NewDistributionProvider(sess, class, distro, status).
-		Reconcile()
+	status.Plan = append(plan, distroPlan...)
+	if len(status.Plan) > 0 {
+		status.Ready = false
+	}
+
+	return nil
 }
 
 func (p CloudFrontProvider) Delete(
+	ctx context.Context,
 	class api.DistributionClassSpec,
 	distro api.Distribution,
 	status *api.DistributionStatus,
-) error {
-	sess, _ := p.Auth.NewSession(class.Providers.CloudFront.Auth, nil)
+) (err error) {
+	ctx, span := p.startSpan(ctx, "CloudFront.Delete", distro, status)
+	defer tracing.End(span, &err)
+	defer classifyError(&err)
 
+	sess, _ := p.Auth.NewSession(ctx, class.Providers.CloudFront.Auth, nil)
+	defer tidyCloudFrontStatus(status)
+
+	distribution := NewDistributionProvider(ctx, sess, class, distro, status, p.events(&distro))
 	if status.ExternalId != "" {
-		err := NewDistributionProvider(sess, class, distro, status).Delete()
-		if err != nil {
+		if err := distribution.Delete(); err != nil {
 			return err
 		}
 	}
 
 	// If the CloudFront distro has not been deleted yet, we can't attempt
-	// to delete the certificate
+	// to delete the certificate or origin access control
 	if status.ExternalId != "" {
 		return nil
 	}
 
-	return NewCertificateProvider(sess, status, nil).Delete()
+	// The staging distribution can only be removed once the primary has
+	// been, as its Continuous Deployment Policy is attached to it
+	if err := NewRolloutProvider(distribution).Delete(); err != nil {
+		return err
+	}
+
+	if cloudFrontStatus(status).StagingDistributionId != "" {
+		return nil
+	}
+
+	if err := NewCertificateProvider(ctx, sess, status, nil, p.events(&distro)).Delete(); err != nil {
+		return err
+	}
+
+	if err := NewBucketPolicyProvider(ctx, sess, distro, status).Delete(); err != nil {
+		return err
+	}
+
+	if err := NewKeyGroupProvider(ctx, sess, distro, status, nil, p.events(&distro)).Delete(); err != nil {
+		return err
+	}
+
+	return NewOriginAccessProvider(ctx, sess, distro, status).Delete()
+}
+
+func (p CloudFrontProvider) Disable(
+	ctx context.Context,
+	class api.DistributionClassSpec,
+	distro api.Distribution,
+	status *api.DistributionStatus,
+) (err error) {
+	ctx, span := p.startSpan(ctx, "CloudFront.Disable", distro, status)
+	defer tracing.End(span, &err)
+	defer classifyError(&err)
+
+	sess, _ := p.Auth.NewSession(ctx, class.Providers.CloudFront.Auth, nil)
+	defer tidyCloudFrontStatus(status)
+
+	return NewDistributionProvider(ctx, sess, class, distro, status, p.events(&distro)).Disable()
 }
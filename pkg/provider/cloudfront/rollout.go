@@ -0,0 +1,465 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// The default time a staging distribution has to deploy a change before
+// the rollout is aborted
+const defaultDeployTimeout = 30 * time.Minute
+
+// The RolloutProvider rolls changes out to a CloudFront distribution
+// via a staging distribution, using CloudFront's continuous deployment
+//
+// The staging distribution and its Continuous Deployment Policy are
+// created the first time a Distribution with a rollout is checked, and
+// are then kept for subsequent rollouts. Whilst no rollout is in
+// progress, the policy is disabled so that all traffic is served by the
+// primary distribution.
+//
+// A rollout goes through the following phases:
+//   - Deploying: the change has been applied to the staging distribution
+//     and the policy enabled. If the staging distribution does not deploy
+//     within the deploy timeout, the rollout is Aborted.
+//   - Soaking: the staging distribution has deployed and is serving its
+//     share of the traffic. Once the soak time has passed, or the promote
+//     annotation is set, the staging config is copied to the primary
+//     distribution.
+type RolloutProvider struct {
+	*DistributionProvider
+}
+
+// Sets up a new instance of the RolloutProvider for the given
+// DistributionProvider
+func NewRolloutProvider(distribution *DistributionProvider) *RolloutProvider {
+	return &RolloutProvider{DistributionProvider: distribution}
+}
+
+// Checks the state of the rollout and progresses it if required
+//
+// This must be called after the primary distribution has been loaded
+// and its desired state generated.
+func (c *RolloutProvider) Reconcile(etag *string) error {
+	staging, stagingEtag, err := c.loadStaging()
+	if err != nil {
+		return err
+	} else if staging == nil {
+		// The staging distribution is copied from the primary before it
+		// has been changed, so that it starts with the current config
+		if staging, stagingEtag, err = c.createStaging(etag); err != nil {
+			return err
+		}
+	}
+
+	// Whether the policy is enabled is worked out up front, so that it is
+	// only updated once, rather than being disabled and re-enabled on
+	// every poll
+	policyId, err := c.ensurePolicy(staging, c.rolloutActive(staging))
+	if err != nil {
+		return err
+	}
+
+	// Attaching the policy doesn't change how the primary distribution
+	// serves traffic, so this is applied directly
+	current := c.CurrentState.DistributionConfig
+	c.DesiredState.ContinuousDeploymentPolicyId = aws.String(policyId)
+	if aws.StringValue(current.ContinuousDeploymentPolicyId) != policyId {
+		attached := &cloudfront.DistributionConfig{}
+		awsutil.Copy(attached, current)
+		attached.ContinuousDeploymentPolicyId = aws.String(policyId)
+		if etag, err = c.update(attached, etag); err != nil {
+			return err
+		}
+		current = c.CurrentState.DistributionConfig
+	}
+
+	// If the primary distribution is up to date, there is no rollout to
+	// progress
+	if configMatches(c.DesiredState, current) {
+		c.Status.Rollout = nil
+		return nil
+	}
+
+	desired := c.stagingConfig(staging)
+	if !configMatches(desired, staging.DistributionConfig) {
+		res, err := c.Client.UpdateDistributionWithContext(c.Context, &cloudfront.UpdateDistributionInput{
+			DistributionConfig: desired,
+			Id:                 staging.Id,
+			IfMatch:            stagingEtag,
+		})
+
+		if err != nil {
+			c.start(staging)
+			return c.abort("Unable to update staging distribution: " + err.Error())
+		}
+
+		staging, stagingEtag = res.Distribution, res.ETag
+		c.start(staging)
+		c.Events.Normal(
+			"RolloutStarted",
+			"Rolling out changes via staging distribution %v: %v",
+			*staging.Id,
+			summariseChanges(c.Status.PendingChanges),
+		)
+	} else if c.Status.Rollout == nil {
+		c.start(staging)
+	}
+
+	// There is a rollout in progress, so we will want to recheck it
+	c.Status.Ready = false
+	rollout := c.Status.Rollout
+
+	if rollout.Phase == api.RolloutAborted {
+		return nil
+	}
+
+	if *staging.Status != "Deployed" {
+		if time.Since(rollout.StartedAt.Time) > c.deployTimeout() {
+			return c.abort("Staging distribution did not deploy within " + c.deployTimeout().String())
+		}
+
+		return nil
+	}
+
+	if rollout.Phase == api.RolloutDeploying {
+		now := metav1.Now()
+		rollout.Phase = api.RolloutSoaking
+		rollout.DeployedAt = &now
+	}
+
+	if c.shouldPromote() {
+		return c.promote(etag, stagingEtag)
+	}
+
+	return nil
+}
+
+// Checks if the continuous deployment policy should be sending traffic
+// to the staging distribution
+//
+// This is the case whilst the primary distribution differs from its
+// desired config, unless the rollout has been aborted and there are no
+// new changes to restart it with.
+func (c *RolloutProvider) rolloutActive(staging *cloudfront.Distribution) bool {
+	current := c.CurrentState.DistributionConfig
+
+	// The policy is attached separately, so it is not a pending change
+	desired := &cloudfront.DistributionConfig{}
+	awsutil.Copy(desired, c.DesiredState)
+	desired.ContinuousDeploymentPolicyId = current.ContinuousDeploymentPolicyId
+	if configMatches(desired, current) {
+		return false
+	}
+
+	if !configMatches(c.stagingConfig(staging), staging.DistributionConfig) {
+		return true
+	}
+
+	return c.Status.Rollout == nil || c.Status.Rollout.Phase != api.RolloutAborted
+}
+
+// Returns the time the staging distribution has to deploy
+func (c *RolloutProvider) deployTimeout() time.Duration {
+	if timeout := c.Distribution.Spec.Rollout.DeployTimeout; timeout != nil {
+		return timeout.Duration
+	}
+
+	return defaultDeployTimeout
+}
+
+// Checks if the change on the staging distribution should be promoted
+// to the primary distribution
+func (c *RolloutProvider) shouldPromote() bool {
+	if _, ok := c.Distribution.Annotations[api.AnnotationPromote]; ok {
+		return true
+	}
+
+	soak := c.Distribution.Spec.Rollout.SoakTime
+	deployed := c.Status.Rollout.DeployedAt
+	return soak != nil && deployed != nil && time.Since(deployed.Time) >= soak.Duration
+}
+
+// Marks a new rollout as started
+func (c *RolloutProvider) start(staging *cloudfront.Distribution) {
+	c.Status.Rollout = &api.RolloutStatus{
+		Phase:           api.RolloutDeploying,
+		StagingId:       *staging.Id,
+		StagingEndpoint: *staging.DomainName,
+		StartedAt:       metav1.Now(),
+	}
+}
+
+// Aborts the rollout, sending all traffic back to the primary
+// distribution
+//
+// The rollout stays aborted until the Distribution is changed again.
+func (c *RolloutProvider) abort(message string) error {
+	c.Status.Ready = false
+	c.Status.Rollout.Phase = api.RolloutAborted
+	c.Status.Rollout.Message = message
+	c.Events.Warning("RolloutAborted", "%v", message)
+
+	staging, _, err := c.loadStaging()
+	if err != nil || staging == nil {
+		return err
+	}
+
+	_, err = c.ensurePolicy(staging, false)
+	return err
+}
+
+// Copies the staging distribution's config to the primary distribution
+func (c *RolloutProvider) promote(etag, stagingEtag *string) error {
+	res, err := c.Client.UpdateDistributionWithStagingConfigWithContext(
+		c.Context,
+		&cloudfront.UpdateDistributionWithStagingConfigInput{
+			Id:                    c.CurrentState.Id,
+			StagingDistributionId: aws.String(cloudFrontStatus(c.Status).StagingDistributionId),
+			IfMatch:               aws.String(*etag + ", " + *stagingEtag),
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	c.setState(res.Distribution, res.ETag)
+	c.Status.Rollout = nil
+	c.Events.Normal("RolloutPromoted", "Promoted staging config to CloudFront distribution %v", *c.CurrentState.Id)
+	return nil
+}
+
+// Calculates the desired config of the staging distribution
+//
+// This is the same as the primary's desired config, except that staging
+// distributions cannot have aliases, or a policy of their own.
+func (c *RolloutProvider) stagingConfig(staging *cloudfront.Distribution) *cloudfront.DistributionConfig {
+	config := &cloudfront.DistributionConfig{}
+	awsutil.Copy(config, c.DesiredState)
+	config.CallerReference = staging.DistributionConfig.CallerReference
+	config.Staging = aws.Bool(true)
+	config.ContinuousDeploymentPolicyId = aws.String("")
+	config.Aliases = &cloudfront.Aliases{Quantity: aws.Int64(0)}
+
+	return config
+}
+
+// Loads the staging distribution
+//
+// If there is no staging distribution, or it has been deleted, nil is
+// returned.
+func (c *RolloutProvider) loadStaging() (*cloudfront.Distribution, *string, error) {
+	status := cloudFrontStatus(c.Status)
+	if status.StagingDistributionId == "" {
+		return nil, nil, nil
+	}
+
+	res, err := c.Client.GetDistributionWithContext(c.Context, &cloudfront.GetDistributionInput{
+		Id: aws.String(status.StagingDistributionId),
+	})
+
+	if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchDistribution); is {
+		status.StagingDistributionId = ""
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	return res.Distribution, res.ETag, nil
+}
+
+// Creates the staging distribution as a copy of the primary
+func (c *RolloutProvider) createStaging(etag *string) (*cloudfront.Distribution, *string, error) {
+	res, err := c.Client.CopyDistributionWithContext(c.Context, &cloudfront.CopyDistributionInput{
+		PrimaryDistributionId: c.CurrentState.Id,
+		CallerReference:       aws.String(string(c.Distribution.UID) + "-staging"),
+		Staging:               aws.Bool(true),
+		IfMatch:               etag,
+	})
+
+	// As with the primary distribution, if the caller reference has
+	// already been taken, this is very likely our staging distribution
+	// with the status having been lost.
+	if is, awserr := isAwsError(err, cloudfront.ErrCodeDistributionAlreadyExists); is {
+		re := regexp.MustCompile(`[A-Z0-9]{14}`)
+		cloudFrontStatus(c.Status).StagingDistributionId = re.FindString(awserr.Message())
+		return c.loadStaging()
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	cloudFrontStatus(c.Status).StagingDistributionId = *res.Distribution.Id
+	return res.Distribution, res.ETag, nil
+}
+
+// Calculates the traffic config of the Continuous Deployment Policy
+func (c *RolloutProvider) trafficConfig() *cloudfront.TrafficConfig {
+	spec := c.Distribution.Spec.Rollout
+	if spec.Header != nil {
+		return &cloudfront.TrafficConfig{
+			Type: aws.String(cloudfront.ContinuousDeploymentPolicyTypeSingleHeader),
+			SingleHeaderConfig: &cloudfront.ContinuousDeploymentSingleHeaderConfig{
+				Header: aws.String(spec.Header.Name),
+				Value:  aws.String(spec.Header.Value),
+			},
+		}
+	}
+
+	return &cloudfront.TrafficConfig{
+		Type: aws.String(cloudfront.ContinuousDeploymentPolicyTypeSingleWeight),
+		SingleWeightConfig: &cloudfront.ContinuousDeploymentSingleWeightConfig{
+			Weight: aws.Float64(float64(spec.WeightPercent) / 100),
+		},
+	}
+}
+
+// Ensures that the Continuous Deployment Policy exists, points at the
+// staging distribution, and is enabled or disabled as requested
+//
+// Returns the Id of the policy.
+func (c *RolloutProvider) ensurePolicy(staging *cloudfront.Distribution, enabled bool) (string, error) {
+	status := cloudFrontStatus(c.Status)
+	config := &cloudfront.ContinuousDeploymentPolicyConfig{
+		Enabled: aws.Bool(enabled),
+		StagingDistributionDnsNames: &cloudfront.StagingDistributionDnsNames{
+			Quantity: aws.Int64(1),
+			Items:    aws.StringSlice([]string{*staging.DomainName}),
+		},
+		TrafficConfig: c.trafficConfig(),
+	}
+
+	if status.ContinuousDeploymentPolicyId != "" {
+		res, err := c.Client.GetContinuousDeploymentPolicyWithContext(c.Context, &cloudfront.GetContinuousDeploymentPolicyInput{
+			Id: aws.String(status.ContinuousDeploymentPolicyId),
+		})
+
+		if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchContinuousDeploymentPolicy); is {
+			status.ContinuousDeploymentPolicyId = ""
+		} else if err != nil {
+			return "", err
+		} else {
+			policy := res.ContinuousDeploymentPolicy
+			if reflect.DeepEqual(config, policy.ContinuousDeploymentPolicyConfig) {
+				return *policy.Id, nil
+			}
+
+			_, err = c.Client.UpdateContinuousDeploymentPolicyWithContext(c.Context, &cloudfront.UpdateContinuousDeploymentPolicyInput{
+				Id:                               policy.Id,
+				IfMatch:                          res.ETag,
+				ContinuousDeploymentPolicyConfig: config,
+			})
+			return *policy.Id, err
+		}
+	}
+
+	res, err := c.Client.CreateContinuousDeploymentPolicyWithContext(c.Context, &cloudfront.CreateContinuousDeploymentPolicyInput{
+		ContinuousDeploymentPolicyConfig: config,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	status.ContinuousDeploymentPolicyId = *res.ContinuousDeploymentPolicy.Id
+	return status.ContinuousDeploymentPolicyId, nil
+}
+
+// Removes the staging distribution and policy if the Distribution no
+// longer has a rollout configured
+func (c *RolloutProvider) Cleanup() error {
+	if c.Distribution.Spec.Rollout != nil {
+		return nil
+	}
+
+	c.Status.Rollout = nil
+	return c.Delete()
+}
+
+// Deletes the Continuous Deployment Policy and the staging distribution
+//
+// The policy can only be deleted once it has been detached from the
+// primary distribution. As with the primary distribution, the staging
+// distribution has to be disabled, and that change deployed, before it
+// can be deleted, so this will need to be called several times.
+func (c *RolloutProvider) Delete() error {
+	status := cloudFrontStatus(c.Status)
+	defer tidyCloudFrontStatus(c.Status)
+
+	if status.ContinuousDeploymentPolicyId != "" {
+		res, err := c.Client.GetContinuousDeploymentPolicyWithContext(c.Context, &cloudfront.GetContinuousDeploymentPolicyInput{
+			Id: aws.String(status.ContinuousDeploymentPolicyId),
+		})
+
+		if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchContinuousDeploymentPolicy); !is {
+			if err != nil {
+				return err
+			}
+
+			_, err = c.Client.DeleteContinuousDeploymentPolicyWithContext(c.Context, &cloudfront.DeleteContinuousDeploymentPolicyInput{
+				Id:      res.ContinuousDeploymentPolicy.Id,
+				IfMatch: res.ETag,
+			})
+			if is, _ := isAwsError(err, cloudfront.ErrCodeNoSuchContinuousDeploymentPolicy); !is && err != nil {
+				return err
+			}
+		}
+
+		status.ContinuousDeploymentPolicyId = ""
+	}
+
+	staging, etag, err := c.loadStaging()
+	if err != nil || staging == nil {
+		return err
+	}
+
+	if *staging.DistributionConfig.Enabled {
+		config := staging.DistributionConfig
+		config.SetEnabled(false)
+		_, err := c.Client.UpdateDistributionWithContext(c.Context, &cloudfront.UpdateDistributionInput{
+			DistributionConfig: config,
+			Id:                 staging.Id,
+			IfMatch:            etag,
+		})
+		return err
+	}
+
+	if *staging.Status == "InProgress" {
+		return nil
+	}
+
+	_, err = c.Client.DeleteDistributionWithContext(c.Context, &cloudfront.DeleteDistributionInput{
+		Id:      staging.Id,
+		IfMatch: etag,
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to delete staging distribution: %w", err)
+	}
+
+	status.StagingDistributionId = ""
+	return nil
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudfront
+
+import (
+	"reflect"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
+)
+
+// Returns the CloudFront specific section of the given status, creating
+// it if it does not already exist
+func cloudFrontStatus(status *api.DistributionStatus) *cfapi.CloudFrontStatus {
+	if status.Providers.CloudFront == nil {
+		status.Providers.CloudFront = &cfapi.CloudFrontStatus{}
+	}
+
+	return status.Providers.CloudFront
+}
+
+// Removes the CloudFront specific section of the given status if it no
+// longer holds any state
+//
+// The DistributionController considers a Distribution to be fully
+// deleted when all of its provider state has been cleared, so this
+// should be called whenever a supporting resource is removed.
+func tidyCloudFrontStatus(status *api.DistributionStatus) {
+	cf := status.Providers.CloudFront
+	if cf != nil && reflect.DeepEqual(*cf, cfapi.CloudFrontStatus{}) {
+		status.Providers.CloudFront = nil
+	}
+}
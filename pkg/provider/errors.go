@@ -0,0 +1,69 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import "errors"
+
+// The broad classes of error which a provider can return, which the
+// DistributionController uses to decide how long to wait before trying
+// again
+type ErrorClass string
+
+const (
+	// The provider's API is rate limiting us
+	ErrorThrottled ErrorClass = "Throttled"
+
+	// The external resource was changed by something else whilst we
+	// were updating it
+	ErrorConflict ErrorClass = "Conflict"
+
+	// An account quota, such as the number of distributions, has been
+	// reached. This is unlikely to be resolved quickly.
+	ErrorQuotaExceeded ErrorClass = "QuotaExceeded"
+
+	// The provider rejected the settings, so retrying will not help
+	// until something changes
+	ErrorInvalidConfig ErrorClass = "InvalidConfig"
+
+	// Anything else
+	ErrorUnknown ErrorClass = "Unknown"
+)
+
+// An error which a provider has classified
+type ClassifiedError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the class of the given error, or ErrorUnknown if it has not
+// been classified
+func ClassOf(err error) ErrorClass {
+	var classified ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+
+	return ErrorUnknown
+}
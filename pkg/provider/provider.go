@@ -16,6 +16,8 @@ limitations under the License.
 package provider
 
 import (
+	"context"
+
 	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
 	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
 )
@@ -33,6 +35,9 @@ type CDNProvider interface {
 	// Creates a specific DistributionProvider for the given Distribution,
 	// ResolvedOrigin, and DistribitionClassSpec
 	//
+	// The Certificate and SigningKey are only given if the Distribution
+	// has TLS or signed URLs configured.
+	//
 	// This is typically called by the DistributionController after it has
 	// determined if this CDNProvider is likely to be interested in the
 	// Distribution (via a Wants() check).
@@ -41,13 +46,42 @@ type CDNProvider interface {
 	// to make changes to its status. The Distribution itself is
 	// immutable.
 	Reconcile(
+		context.Context,
 		api.DistributionClassSpec,
 		api.Distribution,
 		*resolver.Certificate,
+		*resolver.SigningKey,
+		*api.DistributionStatus,
+	) error
+
+	// Works out what Reconcile would change, without making any changes
+	//
+	// The changes are described in the status' Plan field. This must not
+	// make any mutating calls to the external provider.
+	Plan(
+		context.Context,
+		api.DistributionClassSpec,
+		api.Distribution,
+		*resolver.Certificate,
+		*resolver.SigningKey,
 		*api.DistributionStatus,
 	) error
 
 	Delete(
+		context.Context,
+		api.DistributionClassSpec,
+		api.Distribution,
+		*api.DistributionStatus,
+	) error
+
+	// Stops the distribution from serving traffic, without removing it
+	// or any of its supporting resources
+	//
+	// This is used when a Distribution with the "Disable" deletion policy
+	// is deleted. Once this returns without error, the provider no longer
+	// needs to track the distribution.
+	Disable(
+		context.Context,
 		api.DistributionClassSpec,
 		api.Distribution,
 		*api.DistributionStatus,
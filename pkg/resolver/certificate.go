@@ -21,9 +21,16 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/tracing"
 )
 
 // This loads a certificate secret from the kubernetes api, performs
@@ -55,8 +62,53 @@ type Certificate struct {
 
 // Loads the the secret given and parses it as a
 // kubernetes.io/tls-secret
-func (c *CertificateResolver) Resolve(secretRef client.ObjectKey) (*Certificate, error) {
-	if err := c.load(secretRef); err != nil {
+func (c *CertificateResolver) Resolve(
+	ctx context.Context,
+	secretRef client.ObjectKey,
+) (_ *Certificate, err error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"CertificateResolver.Resolve",
+		attribute.String("cdn.secret", secretRef.Namespace+"/"+secretRef.Name),
+	)
+	defer tracing.End(span, &err)
+
+	if err := c.load(ctx, secretRef); err != nil {
+		return nil, err
+	}
+
+	c.resolved = &Certificate{}
+	c.parseCrt()
+	c.parseKey()
+
+	return c.resolved, nil
+}
+
+// Loads the certificate for a Distribution's TLS settings, either from
+// its secret, or from the resource given in its certificateRef
+func (c *CertificateResolver) ResolveTLS(
+	ctx context.Context,
+	namespace string,
+	tls api.TLSSpec,
+) (*Certificate, error) {
+	ref := tls.CertificateRef
+	if ref == nil {
+		return c.Resolve(ctx, client.ObjectKey{Namespace: namespace, Name: tls.SecretRef})
+	}
+
+	ctx, span := tracing.Start(
+		ctx,
+		"CertificateResolver.ResolveTLS",
+		attribute.String("cdn.certificate_ref", ref.Kind+"/"+namespace+"/"+ref.Name),
+	)
+	var err error
+	defer tracing.End(span, &err)
+
+	if ref.Kind != "Route" {
+		err = fmt.Errorf("Unsupported certificateRef kind %q. Expecting Route", ref.Kind)
+		return nil, err
+	}
+	if err = c.loadRoute(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}); err != nil {
 		return nil, err
 	}
 
@@ -67,10 +119,43 @@ func (c *CertificateResolver) Resolve(secretRef client.ObjectKey) (*Certificate,
 	return c.resolved, nil
 }
 
+// Loads the inline certificate from an OpenShift Route
+//
+// This is turned into a synthetic kubernetes.io/tls secret, so that it
+// is checked and parsed in the same way as a real one. Any CA
+// certificate is added to the chain.
+func (c *CertificateResolver) loadRoute(ctx context.Context, key client.ObjectKey) error {
+	route := NewRoute()
+	if err := c.Get(ctx, key, route); err != nil {
+		return fmt.Errorf("Could not find the Route \"%v\"", key.Name)
+	}
+
+	crt, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "certificate")
+	privateKey, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "key")
+	ca, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "caCertificate")
+	if crt == "" || privateKey == "" {
+		return fmt.Errorf("Route \"%v\" does not have an inline TLS certificate and key", key.Name)
+	}
+	if ca != "" {
+		crt = strings.TrimRight(crt, "\n") + "\n" + ca
+	}
+
+	c.secret = corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte(crt),
+			corev1.TLSPrivateKeyKey: []byte(privateKey),
+		},
+	}
+
+	return nil
+}
+
 // Loads a secret and checks that it is of the type
 // kubernetes.io/tls-cert
-func (c *CertificateResolver) load(secretRef client.ObjectKey) error {
-	c.Get(context.TODO(), secretRef, &c.secret)
+func (c *CertificateResolver) load(ctx context.Context, secretRef client.ObjectKey) error {
+	c.Get(ctx, secretRef, &c.secret)
 
 	if c.secret.Type == "" {
 		return fmt.Errorf("Could not find the TLS secret \"%v\"", secretRef.Name)
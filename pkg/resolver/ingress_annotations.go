@@ -0,0 +1,235 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/util"
+)
+
+// Annotations which override the values CDN Manager would otherwise
+// derive from an Ingress
+const (
+	AnnotationOriginHost      = "cdn.redcoat.dev/origin-host"
+	AnnotationOriginHTTPPort  = "cdn.redcoat.dev/origin-http-port"
+	AnnotationOriginHTTPSPort = "cdn.redcoat.dev/origin-https-port"
+	AnnotationTLSMode         = "cdn.redcoat.dev/tls-mode"
+	AnnotationHosts           = "cdn.redcoat.dev/hosts"
+	AnnotationExcludeHosts    = "cdn.redcoat.dev/exclude-hosts"
+	AnnotationDeletionPolicy  = "cdn.redcoat.dev/deletion-policy"
+	AnnotationCachePolicy     = "cdn.redcoat.dev/cache-policy"
+)
+
+// The overrides given in an Ingress' annotations. Empty fields have not
+// been overridden.
+type IngressOverrides struct {
+	OriginHost     string
+	HTTPPort       int32
+	HTTPSPort      int32
+	TLSMode        string
+	Hosts          []string
+	ExcludeHosts   []string
+	DeletionPolicy api.DeletionPolicy
+	CachePolicyId  string
+}
+
+// Reads the overrides from the object's annotations
+//
+// Any annotations with invalid values are ignored, and returned as
+// errors, so that they can be reported.
+func ParseIngressOverrides(object client.Object) (IngressOverrides, []error) {
+	var overrides IngressOverrides
+	var errs []error
+	annotations := object.GetAnnotations()
+
+	invalid := func(name, value, problem string) {
+		errs = append(errs, fmt.Errorf("Annotation %v has an invalid value %q: %v", name, value, problem))
+	}
+
+	if value, ok := annotations[AnnotationOriginHost]; ok {
+		if problem := checkHost(value, false); problem != "" {
+			invalid(AnnotationOriginHost, value, problem)
+		} else {
+			overrides.OriginHost = value
+		}
+	}
+
+	ports := map[string]*int32{
+		AnnotationOriginHTTPPort:  &overrides.HTTPPort,
+		AnnotationOriginHTTPSPort: &overrides.HTTPSPort,
+	}
+	for name, port := range ports {
+		value, ok := annotations[name]
+		if !ok {
+			continue
+		}
+
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || parsed < 1 || parsed > 65535 {
+			invalid(name, value, "must be a port number between 1 and 65535")
+		} else {
+			*port = int32(parsed)
+		}
+	}
+
+	if value, ok := annotations[AnnotationTLSMode]; ok {
+		switch value {
+		case "redirect", "only", "both":
+			overrides.TLSMode = value
+		default:
+			invalid(AnnotationTLSMode, value, "must be one of redirect, only or both")
+		}
+	}
+
+	hostLists := map[string]*[]string{
+		AnnotationHosts:        &overrides.Hosts,
+		AnnotationExcludeHosts: &overrides.ExcludeHosts,
+	}
+	for name, list := range hostLists {
+		value, ok := annotations[name]
+		if !ok {
+			continue
+		}
+
+		hosts := util.SplitList(value)
+		if len(hosts) == 0 {
+			invalid(name, value, "must be a comma separated list of hosts")
+			continue
+		}
+		for _, host := range hosts {
+			if problem := checkHost(host, true); problem != "" {
+				invalid(name, host, problem)
+				hosts = nil
+				break
+			}
+		}
+		*list = hosts
+	}
+
+	if value, ok := annotations[AnnotationDeletionPolicy]; ok {
+		switch policy := api.DeletionPolicy(value); policy {
+		case api.DeletionPolicyDelete, api.DeletionPolicyRetain, api.DeletionPolicyDisable:
+			overrides.DeletionPolicy = policy
+		default:
+			invalid(AnnotationDeletionPolicy, value, "must be one of Delete, Retain or Disable")
+		}
+	}
+
+	if value, ok := annotations[AnnotationCachePolicy]; ok {
+		if value == "" {
+			invalid(AnnotationCachePolicy, value, "must not be empty")
+		} else {
+			overrides.CachePolicyId = value
+		}
+	}
+
+	return overrides, errs
+}
+
+// The TLS secret for resources which do not have TLS settings of their
+// own, such as Services
+const AnnotationTLSSecret = "cdn.redcoat.dev/tls-secret"
+
+// Returns the TLS secret named in the object's annotations, or an empty
+// string if there isn't one
+func GetTLSSecret(object client.Object) (string, error) {
+	value, ok := object.GetAnnotations()[AnnotationTLSSecret]
+	if !ok {
+		return "", nil
+	}
+
+	if problems := validation.IsDNS1123Subdomain(value); len(problems) > 0 {
+		return "", fmt.Errorf(
+			"Annotation %v has an invalid value %q: %v",
+			AnnotationTLSSecret,
+			value,
+			strings.Join(problems, ", "),
+		)
+	}
+
+	return value, nil
+}
+
+// Checks if a host should be served, according to the hosts and
+// exclude-hosts annotations
+func (o *IngressOverrides) Includes(host string) bool {
+	if o.Hosts != nil && !contains(o.Hosts, host) {
+		return false
+	}
+
+	return !contains(o.ExcludeHosts, host)
+}
+
+// Sets the overridden values on a Distribution derived from the Ingress
+func (o *IngressOverrides) Apply(distro *api.Distribution) {
+	origin := &distro.Spec.Origin
+	if o.OriginHost != "" {
+		origin.Host = o.OriginHost
+	}
+	if o.HTTPPort != 0 {
+		origin.HTTPPort = o.HTTPPort
+	}
+	if o.HTTPSPort != 0 {
+		origin.HTTPSPort = o.HTTPSPort
+	}
+
+	if tls := distro.Spec.TLS; tls != nil && o.TLSMode != "" {
+		tls.Mode = o.TLSMode
+	}
+
+	if o.DeletionPolicy != "" {
+		distro.Spec.DeletionPolicy = o.DeletionPolicy
+	}
+	if o.CachePolicyId != "" {
+		distro.Spec.CachePolicyId = o.CachePolicyId
+	}
+}
+
+// Returns the problem with the host name, or an empty string if it is
+// valid
+func checkHost(host string, allowWildcard bool) string {
+	if net.ParseIP(host) != nil {
+		return "must be a host name, not an IP address"
+	}
+
+	var problems []string
+	if allowWildcard && strings.HasPrefix(host, "*.") {
+		problems = validation.IsWildcardDNS1123Subdomain(host)
+	} else {
+		problems = validation.IsDNS1123Subdomain(host)
+	}
+
+	return strings.Join(problems, ", ")
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
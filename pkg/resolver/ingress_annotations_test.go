@@ -0,0 +1,174 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+func TestParseIngressOverrides(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        IngressOverrides
+		errors      int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "all valid",
+			annotations: map[string]string{
+				AnnotationOriginHost:      "origin.example.com",
+				AnnotationOriginHTTPPort:  "8080",
+				AnnotationOriginHTTPSPort: "8443",
+				AnnotationTLSMode:         "only",
+				AnnotationHosts:           "example.com, *.example.com",
+				AnnotationExcludeHosts:    "admin.example.com",
+				AnnotationDeletionPolicy:  "Retain",
+				AnnotationCachePolicy:     "658327ea-f89d-4fab-a63d-7e88639e58f6",
+			},
+			want: IngressOverrides{
+				OriginHost:     "origin.example.com",
+				HTTPPort:       8080,
+				HTTPSPort:      8443,
+				TLSMode:        "only",
+				Hosts:          []string{"example.com", "*.example.com"},
+				ExcludeHosts:   []string{"admin.example.com"},
+				DeletionPolicy: api.DeletionPolicyRetain,
+				CachePolicyId:  "658327ea-f89d-4fab-a63d-7e88639e58f6",
+			},
+		},
+		{
+			name:        "origin host is an IP address",
+			annotations: map[string]string{AnnotationOriginHost: "10.0.0.1"},
+			errors:      1,
+		},
+		{
+			name:        "wildcard origin host",
+			annotations: map[string]string{AnnotationOriginHost: "*.example.com"},
+			errors:      1,
+		},
+		{
+			name: "invalid ports",
+			annotations: map[string]string{
+				AnnotationOriginHTTPPort:  "0",
+				AnnotationOriginHTTPSPort: "https",
+			},
+			errors: 2,
+		},
+		{
+			name:        "port out of range",
+			annotations: map[string]string{AnnotationOriginHTTPSPort: "65536"},
+			errors:      1,
+		},
+		{
+			name:        "highest port",
+			annotations: map[string]string{AnnotationOriginHTTPSPort: "65535"},
+			want:        IngressOverrides{HTTPSPort: 65535},
+		},
+		{
+			name:        "invalid TLS mode",
+			annotations: map[string]string{AnnotationTLSMode: "sometimes"},
+			errors:      1,
+		},
+		{
+			name:        "empty host list",
+			annotations: map[string]string{AnnotationHosts: " , "},
+			errors:      1,
+		},
+		{
+			name:        "one invalid host drops the whole list",
+			annotations: map[string]string{AnnotationExcludeHosts: "a.com,b_c.com"},
+			errors:      1,
+		},
+		{
+			name:        "invalid deletion policy",
+			annotations: map[string]string{AnnotationDeletionPolicy: "delete"},
+			errors:      1,
+		},
+		{
+			name:        "empty cache policy",
+			annotations: map[string]string{AnnotationCachePolicy: ""},
+			errors:      1,
+		},
+		{
+			name: "invalid values do not affect valid ones",
+			annotations: map[string]string{
+				AnnotationOriginHost:     "origin.example.com",
+				AnnotationOriginHTTPPort: "-1",
+			},
+			want:   IngressOverrides{OriginHost: "origin.example.com"},
+			errors: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ingress := &networking.Ingress{}
+			ingress.SetAnnotations(test.annotations)
+
+			got, errs := ParseIngressOverrides(ingress)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("unexpected overrides\n got: %+v\nwant: %+v", got, test.want)
+			}
+			if len(errs) != test.errors {
+				t.Errorf("expected %v errors, got %v: %v", test.errors, len(errs), errs)
+			}
+		})
+	}
+}
+
+func TestIngressOverridesIncludes(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides IngressOverrides
+		host      string
+		want      bool
+	}{
+		{"no overrides", IngressOverrides{}, "a.com", true},
+		{"in hosts", IngressOverrides{Hosts: []string{"a.com"}}, "a.com", true},
+		{"not in hosts", IngressOverrides{Hosts: []string{"a.com"}}, "b.com", false},
+		{"excluded", IngressOverrides{ExcludeHosts: []string{"a.com"}}, "a.com", false},
+		{"not excluded", IngressOverrides{ExcludeHosts: []string{"a.com"}}, "b.com", true},
+		{
+			"exclude wins over hosts",
+			IngressOverrides{Hosts: []string{"a.com"}, ExcludeHosts: []string{"a.com"}},
+			"a.com",
+			false,
+		},
+		{
+			"wildcards are matched exactly",
+			IngressOverrides{Hosts: []string{"*.a.com"}},
+			"www.a.com",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.overrides.Includes(test.host); got != test.want {
+				t.Errorf("Includes(%q) = %v, want %v", test.host, got, test.want)
+			}
+		})
+	}
+}
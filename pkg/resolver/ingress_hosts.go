@@ -0,0 +1,190 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+)
+
+// A set of an Ingress' hosts which are served by the same Distribution
+type IngressHostGroup struct {
+	// Added to the Ingress' name to give the Distribution's name. This is
+	// empty for the Ingress' main Distribution.
+	Suffix string
+
+	Hosts []string
+
+	// The TLS secret for the hosts, or empty if they are served over
+	// plain HTTP
+	SecretName string
+}
+
+// Splits an Ingress' hosts into the Distributions needed to serve them
+//
+// Each TLS secret gets its own Distribution, serving the hosts of every
+// IngressTLS entry which uses it. Hosts from the Ingress' rules which
+// are not covered by any TLS entry are grouped into a plain HTTP
+// Distribution. The first of these Distributions which has any hosts
+// takes the Ingress' own name, and the others are named after their
+// secret, so that reordering the TLS entries doesn't rename them.
+//
+// If the Ingress' annotations give a list of hosts, these replace the
+// hosts from its rules, and only TLS entries' hosts which are in the
+// list are kept. Excluded hosts are always left out.
+//
+// Any hosts which cannot be served are described in the returned
+// warnings.
+func GroupIngressHosts(
+	ingress *networking.Ingress,
+	overrides *IngressOverrides,
+) ([]IngressHostGroup, []string) {
+	var groups []IngressHostGroup
+	var warnings []string
+	claimed := map[string]bool{}
+	bySecret := map[string]int{}
+
+	for i, tls := range ingress.Spec.TLS {
+		if len(tls.Hosts) == 0 {
+			warnings = append(warnings, fmt.Sprintf(
+				"TLS entry %d has no hosts, so was skipped", i,
+			))
+			continue
+		}
+		if tls.SecretName == "" {
+			warnings = append(warnings, fmt.Sprintf(
+				"TLS entry %d has no secretName, so its hosts will be served over plain HTTP", i,
+			))
+			continue
+		}
+
+		idx, ok := bySecret[tls.SecretName]
+		if !ok {
+			idx = len(groups)
+			bySecret[tls.SecretName] = idx
+			groups = append(groups, IngressHostGroup{SecretName: tls.SecretName})
+		}
+		group := &groups[idx]
+		for _, host := range tls.Hosts {
+			if !overrides.Includes(host) {
+				continue
+			}
+			if claimed[host] {
+				warnings = append(warnings, fmt.Sprintf(
+					"Host %v is in more than one TLS entry, so only the first is used", host,
+				))
+				continue
+			}
+			claimed[host] = true
+			group.Hosts = append(group.Hosts, host)
+		}
+	}
+
+	// The first group which is actually used takes the Ingress' own
+	// name, even if earlier TLS entries were skipped, so that its
+	// existing Distribution is kept
+	used := []IngressHostGroup{}
+	suffixes := map[string]bool{}
+	for _, group := range groups {
+		if len(group.Hosts) == 0 {
+			continue
+		}
+		if len(used) > 0 {
+			group.Suffix = secretSuffix(group.SecretName, suffixes)
+		}
+		used = append(used, group)
+	}
+	groups = used
+
+	var tlsHosts []string
+	for host := range claimed {
+		tlsHosts = append(tlsHosts, host)
+	}
+
+	plain := IngressHostGroup{}
+	if len(groups) > 0 {
+		plain.Suffix = "-http"
+	}
+	hosts := overrides.Hosts
+	if hosts == nil {
+		for _, rule := range ingress.Spec.Rules {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	for _, host := range hosts {
+		if host == "" || claimed[host] || !overrides.Includes(host) {
+			continue
+		}
+		claimed[host] = true
+
+		// A rule for a host which is matched by a wildcard TLS entry is
+		// already served by that entry's Distribution
+		if CoversHost(tlsHosts, host) {
+			continue
+		}
+		plain.Hosts = append(plain.Hosts, host)
+	}
+
+	// An Ingress without any hosts still gets a Distribution, which can
+	// be reached via the provider's own domain name
+	if len(plain.Hosts) > 0 || len(groups) == 0 {
+		groups = append(groups, plain)
+	}
+
+	return groups, warnings
+}
+
+// Returns the suffix for the Distribution using the given TLS secret
+//
+// Secret names may contain dots, which are swapped for dashes. As this
+// could make two secrets' suffixes the same (eg "a.b" and "a-b"), a
+// number is added to any suffix which has already been taken.
+func secretSuffix(secretName string, taken map[string]bool) string {
+	base := "-tls-" + strings.ReplaceAll(secretName, ".", "-")
+	suffix := base
+	for n := 2; taken[suffix]; n++ {
+		suffix = fmt.Sprintf("%v-%d", base, n)
+	}
+	taken[suffix] = true
+
+	return suffix
+}
+
+// Checks if any of the given names covers the host
+//
+// A wildcard name covers a single label, so "*.example.com" covers
+// "www.example.com", but not "example.com" or "a.b.example.com". A
+// wildcard host must be matched exactly.
+func CoversHost(names []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == host {
+			return true
+		}
+
+		if strings.HasPrefix(name, "*.") && !strings.HasPrefix(host, "*.") {
+			if i := strings.Index(host, "."); i > 0 && host[i:] == name[1:] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+)
+
+func TestCoversHost(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		host  string
+		want  bool
+	}{
+		{"exact match", []string{"example.com"}, "example.com", true},
+		{"case insensitive", []string{"Example.COM"}, "example.com", true},
+		{"no match", []string{"example.com"}, "www.example.com", false},
+		{"wildcard covers one label", []string{"*.example.com"}, "www.example.com", true},
+		{"wildcard does not cover apex", []string{"*.example.com"}, "example.com", false},
+		{"wildcard does not cover two labels", []string{"*.example.com"}, "a.b.example.com", false},
+		{"wildcard host matches exactly", []string{"*.example.com"}, "*.example.com", true},
+		{"wildcard host is not covered by wider wildcard", []string{"*.com"}, "*.example.com", false},
+		{"any name matches", []string{"other.com", "*.example.com"}, "api.example.com", true},
+		{"no names", nil, "example.com", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CoversHost(test.names, test.host); got != test.want {
+				t.Errorf("CoversHost(%v, %q) = %v, want %v", test.names, test.host, got, test.want)
+			}
+		})
+	}
+}
+
+// Builds an Ingress with a rule for each of the given hosts
+func newIngress(tls []networking.IngressTLS, hosts ...string) *networking.Ingress {
+	ingress := &networking.Ingress{}
+	ingress.Name = "web"
+	ingress.Spec.TLS = tls
+	for _, host := range hosts {
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networking.IngressRule{Host: host})
+	}
+
+	return ingress
+}
+
+func TestGroupIngressHosts(t *testing.T) {
+	tests := []struct {
+		name      string
+		ingress   *networking.Ingress
+		overrides IngressOverrides
+		want      []IngressHostGroup
+		warnings  int
+	}{
+		{
+			name:    "no hosts",
+			ingress: newIngress(nil),
+			want:    []IngressHostGroup{{}},
+		},
+		{
+			name:    "plain HTTP only",
+			ingress: newIngress(nil, "a.com", "b.com", ""),
+			want:    []IngressHostGroup{{Hosts: []string{"a.com", "b.com"}}},
+		},
+		{
+			name: "single TLS entry",
+			ingress: newIngress(
+				[]networking.IngressTLS{{Hosts: []string{"a.com"}, SecretName: "a"}},
+				"a.com",
+			),
+			want: []IngressHostGroup{{Hosts: []string{"a.com"}, SecretName: "a"}},
+		},
+		{
+			name: "TLS and plain HTTP",
+			ingress: newIngress(
+				[]networking.IngressTLS{
+					{Hosts: []string{"a.com"}, SecretName: "a"},
+					{Hosts: []string{"b.com"}, SecretName: "b"},
+				},
+				"a.com", "b.com", "c.com",
+			),
+			want: []IngressHostGroup{
+				{Hosts: []string{"a.com"}, SecretName: "a"},
+				{Suffix: "-tls-b", Hosts: []string{"b.com"}, SecretName: "b"},
+				{Suffix: "-http", Hosts: []string{"c.com"}},
+			},
+		},
+		{
+			name: "wildcard TLS entry covers rules",
+			ingress: newIngress(
+				[]networking.IngressTLS{{Hosts: []string{"*.a.com"}, SecretName: "a"}},
+				"www.a.com", "a.com",
+			),
+			want: []IngressHostGroup{
+				{Hosts: []string{"*.a.com"}, SecretName: "a"},
+				{Suffix: "-http", Hosts: []string{"a.com"}},
+			},
+		},
+		{
+			name: "duplicate TLS hosts",
+			ingress: newIngress([]networking.IngressTLS{
+				{Hosts: []string{"a.com", "b.com"}, SecretName: "a"},
+				{Hosts: []string{"b.com"}, SecretName: "b"},
+			}),
+			want:     []IngressHostGroup{{Hosts: []string{"a.com", "b.com"}, SecretName: "a"}},
+			warnings: 1,
+		},
+		{
+			name: "skipped first TLS entry",
+			ingress: newIngress([]networking.IngressTLS{
+				{Hosts: []string{"a.com"}},
+				{SecretName: "none"},
+				{Hosts: []string{"b.com"}, SecretName: "b"},
+				{Hosts: []string{"c.com"}, SecretName: "c"},
+			}, "a.com"),
+			want: []IngressHostGroup{
+				{Hosts: []string{"b.com"}, SecretName: "b"},
+				{Suffix: "-tls-c", Hosts: []string{"c.com"}, SecretName: "c"},
+				{Suffix: "-http", Hosts: []string{"a.com"}},
+			},
+			warnings: 2,
+		},
+		{
+			name: "TLS entries sharing a secret",
+			ingress: newIngress([]networking.IngressTLS{
+				{Hosts: []string{"a.com"}, SecretName: "a"},
+				{Hosts: []string{"b.com"}, SecretName: "b"},
+				{Hosts: []string{"c.com"}, SecretName: "a"},
+			}),
+			want: []IngressHostGroup{
+				{Hosts: []string{"a.com", "c.com"}, SecretName: "a"},
+				{Suffix: "-tls-b", Hosts: []string{"b.com"}, SecretName: "b"},
+			},
+		},
+		{
+			name: "secret names with dots",
+			ingress: newIngress([]networking.IngressTLS{
+				{Hosts: []string{"a.com"}, SecretName: "a"},
+				{Hosts: []string{"b.com"}, SecretName: "b.com"},
+				{Hosts: []string{"c.com"}, SecretName: "b-com"},
+			}),
+			want: []IngressHostGroup{
+				{Hosts: []string{"a.com"}, SecretName: "a"},
+				{Suffix: "-tls-b-com", Hosts: []string{"b.com"}, SecretName: "b.com"},
+				{Suffix: "-tls-b-com-2", Hosts: []string{"c.com"}, SecretName: "b-com"},
+			},
+		},
+		{
+			name: "reordered TLS entries keep their names",
+			ingress: newIngress([]networking.IngressTLS{
+				{Hosts: []string{"a.com"}, SecretName: "a"},
+				{Hosts: []string{"c.com"}, SecretName: "c"},
+				{Hosts: []string{"b.com"}, SecretName: "b"},
+			}),
+			want: []IngressHostGroup{
+				{Hosts: []string{"a.com"}, SecretName: "a"},
+				{Suffix: "-tls-c", Hosts: []string{"c.com"}, SecretName: "c"},
+				{Suffix: "-tls-b", Hosts: []string{"b.com"}, SecretName: "b"},
+			},
+		},
+		{
+			name: "first TLS entry entirely excluded",
+			ingress: newIngress([]networking.IngressTLS{
+				{Hosts: []string{"a.com"}, SecretName: "a"},
+				{Hosts: []string{"b.com"}, SecretName: "b"},
+			}),
+			overrides: IngressOverrides{ExcludeHosts: []string{"a.com"}},
+			want:      []IngressHostGroup{{Hosts: []string{"b.com"}, SecretName: "b"}},
+		},
+		{
+			name: "hosts annotation replaces rules",
+			ingress: newIngress(
+				[]networking.IngressTLS{{Hosts: []string{"a.com", "b.com"}, SecretName: "a"}},
+				"a.com", "c.com",
+			),
+			overrides: IngressOverrides{Hosts: []string{"a.com", "d.com"}},
+			want: []IngressHostGroup{
+				{Hosts: []string{"a.com"}, SecretName: "a"},
+				{Suffix: "-http", Hosts: []string{"d.com"}},
+			},
+		},
+		{
+			name:      "excluded hosts",
+			ingress:   newIngress(nil, "a.com", "b.com"),
+			overrides: IngressOverrides{ExcludeHosts: []string{"b.com"}},
+			want:      []IngressHostGroup{{Hosts: []string{"a.com"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, warnings := GroupIngressHosts(test.ingress, &test.overrides)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("unexpected groups\n got: %+v\nwant: %+v", got, test.want)
+			}
+			if len(warnings) != test.warnings {
+				t.Errorf("expected %v warnings, got %v: %v", test.warnings, len(warnings), warnings)
+			}
+		})
+	}
+}
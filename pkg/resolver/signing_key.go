@@ -0,0 +1,147 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"gitlab.com/redcoat/cdn-manager/pkg/tracing"
+)
+
+// This loads a URL signing key pair secret from the kubernetes api and
+// returns its public key
+type SigningKeyResolver struct {
+	client.Client
+}
+
+// Holds the public half of a loaded signing key pair
+type SigningKey struct {
+	// The PEM encoded (PKIX) public key
+	PublicKey []byte
+
+	// The hex encoded SHA-256 fingerprint of the public key
+	Fingerprint string
+}
+
+// Loads the given secret and extracts its RSA public key
+//
+// If the secret has a "public.pem" field, this is used. Otherwise the
+// public key is derived from the "private.pem" field.
+func (c *SigningKeyResolver) Resolve(
+	ctx context.Context,
+	secretRef client.ObjectKey,
+) (_ *SigningKey, err error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"SigningKeyResolver.Resolve",
+		attribute.String("cdn.secret", secretRef.Namespace+"/"+secretRef.Name),
+	)
+	defer tracing.End(span, &err)
+
+	var secret corev1.Secret
+	if err := c.Get(ctx, secretRef, &secret); err != nil {
+		return nil, err
+	}
+
+	var key *rsa.PublicKey
+	if raw := secret.Data["public.pem"]; len(raw) > 0 {
+		key, err = parsePublicKey(raw)
+	} else if raw := secret.Data["private.pem"]; len(raw) > 0 {
+		key, err = parsePrivateKey(raw)
+	} else {
+		err = fmt.Errorf("does not have the required data \"private.pem\"")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Signing secret \"%v\" %v", secretRef.Name, err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := sha256.Sum256(der)
+	return &SigningKey{
+		PublicKey: pem.EncodeToMemory(&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: der,
+		}),
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+	}, nil
+}
+
+// Parses a PEM encoded RSA public key, in either PKIX or PKCS #1 form
+func parsePublicKey(raw []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("has an invalid public key")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("has a public key which is not an RSA key")
+}
+
+// Parses a PEM encoded RSA private key, in either PKCS #8 or PKCS #1
+// form, and returns its public key
+func parsePrivateKey(raw []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("has an invalid private key")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &key.PublicKey, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return &rsaKey.PublicKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("has a private key which is not an RSA key")
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// Gateways are used via unstructured objects, so that the controller
+// does not depend on a particular release of the Gateway API
+var GatewayGVK = schema.GroupVersionKind{
+	Group:   "gateway.networking.k8s.io",
+	Version: "v1",
+	Kind:    "Gateway",
+}
+
+// Returns an empty Gateway
+func NewGateway() *unstructured.Unstructured {
+	gateway := &unstructured.Unstructured{}
+	gateway.SetGroupVersionKind(GatewayGVK)
+	return gateway
+}
+
+// OpenShift Routes are also used via unstructured objects, so that the
+// controller does not depend on OpenShift's API packages
+var RouteGVK = schema.GroupVersionKind{
+	Group:   "route.openshift.io",
+	Version: "v1",
+	Kind:    "Route",
+}
+
+// Returns an empty OpenShift Route
+func NewRoute() *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(RouteGVK)
+	return route
+}
+
+// Looks up the origin host for a Distribution's targetRef
+type TargetResolver struct {
+	client.Client
+}
+
+// Returns the load balancer address of the target, or an empty string if
+// it does not have one yet
+func (t *TargetResolver) Resolve(
+	ctx context.Context,
+	namespace string,
+	ref api.ObjectReference,
+) (string, error) {
+	key := client.ObjectKey{Namespace: namespace, Name: ref.Name}
+
+	switch ref.Kind {
+	case "Ingress":
+		var ingress networking.Ingress
+		if err := t.Get(ctx, key, &ingress); err != nil {
+			return "", err
+		}
+		return GetIngressHost(ingress.Status.LoadBalancer.Ingress), nil
+	case "Service":
+		var svc corev1.Service
+		if err := t.Get(ctx, key, &svc); err != nil {
+			return "", err
+		}
+		return GetIngressHost(svc.Status.LoadBalancer.Ingress), nil
+	case "Gateway":
+		gateway := NewGateway()
+		if err := t.Get(ctx, key, gateway); err != nil {
+			return "", err
+		}
+		return GetGatewayHost(gateway), nil
+	}
+
+	return "", fmt.Errorf("Unsupported targetRef kind %q. Expecting Ingress, Service or Gateway", ref.Kind)
+}
+
+// Returns the Gateway's address to use as the origin, preferring host
+// names, as CloudFront does not support IP address origins
+func GetGatewayHost(gateway *unstructured.Unstructured) string {
+	addresses, _, _ := unstructured.NestedSlice(gateway.Object, "status", "addresses")
+
+	var first string
+	for _, item := range addresses {
+		address, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		value, _ := address["value"].(string)
+		if kind, _ := address["type"].(string); kind == "Hostname" {
+			return value
+		}
+		if first == "" {
+			first = value
+		}
+	}
+
+	return first
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package standalone
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/webhook"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(api.AddToScheme(scheme))
+}
+
+// A Bundle is a set of Distributions, DistributionClasses and
+// ClusterDistributionClasses, read from YAML rather than from the
+// api-server
+type Bundle struct {
+	Distributions              []api.Distribution
+	DistributionClasses        []api.DistributionClass
+	ClusterDistributionClasses []api.ClusterDistributionClass
+}
+
+// A Source loads the current Bundle
+//
+// A Source must return an error, rather than an empty Bundle, if it is
+// unable to read its files, as an empty Bundle causes every
+// Distribution to be deleted.
+type Source interface {
+	Load(ctx context.Context) (*Bundle, error)
+}
+
+// Reads a Bundle from the .yaml, .yml and .json files in a directory,
+// such as a mounted ConfigMap or a checked out git repository
+//
+// Subdirectories and hidden files are ignored.
+type DirectorySource struct {
+	Path string
+}
+
+func (s DirectorySource) Load(ctx context.Context) (*Bundle, error) {
+	files, err := ioutil.ReadDir(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") || !isManifest(name) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(s.Path, name))
+		if err != nil {
+			return nil, err
+		}
+		if err := bundle.add(name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return bundle, bundle.validate()
+}
+
+// Reads a Bundle from each of the values in a ConfigMap
+//
+// The ConfigMap is not watched, it is read again each time the Client
+// reloads, so changes are picked up on the next resync. This does avoid
+// waiting for the kubelet to update a mounted volume as well.
+type ConfigMapSource struct {
+	Client client.Reader
+	Key    client.ObjectKey
+}
+
+func (s ConfigMapSource) Load(ctx context.Context) (*Bundle, error) {
+	var configMap corev1.ConfigMap
+	if err := s.Client.Get(ctx, s.Key, &configMap); err != nil {
+		return nil, err
+	}
+
+	// Keys are sorted so that errors are reported consistently
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bundle := &Bundle{}
+	for _, key := range keys {
+		if err := bundle.add(key, []byte(configMap.Data[key])); err != nil {
+			return nil, err
+		}
+	}
+
+	return bundle, bundle.validate()
+}
+
+// Checks if the given file name has an extension we can decode
+func isManifest(name string) bool {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// Decodes each of the documents in the given YAML or JSON file and
+// adds them to the Bundle
+//
+// The same defaults are applied as the admission webhooks would, as
+// Distributions in a Bundle never pass through them.
+func (b *Bundle) add(file string, data []byte) error {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%v: %w", file, err)
+		}
+
+		// Skip documents which are empty or only contain comments
+		var meta runtime.TypeMeta
+		if err := yaml.Unmarshal(doc, &meta); err != nil {
+			return fmt.Errorf("%v: %w", file, err)
+		} else if meta.Kind == "" && meta.APIVersion == "" {
+			continue
+		}
+
+		obj, gvk, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return fmt.Errorf("%v: %w", file, err)
+		}
+
+		switch obj := obj.(type) {
+		case *api.Distribution:
+			if obj.Namespace == "" {
+				obj.Namespace = corev1.NamespaceDefault
+			}
+			webhook.DefaultDistribution(obj)
+			b.Distributions = append(b.Distributions, *obj)
+		case *api.DistributionClass:
+			if obj.Namespace == "" {
+				obj.Namespace = corev1.NamespaceDefault
+			}
+			webhook.DefaultClassSpec(&obj.Spec)
+			b.DistributionClasses = append(b.DistributionClasses, *obj)
+		case *api.ClusterDistributionClass:
+			webhook.DefaultClassSpec(&obj.Spec)
+			b.ClusterDistributionClasses = append(b.ClusterDistributionClasses, *obj)
+		default:
+			return fmt.Errorf("%v: %v is not supported in a bundle", file, gvk.Kind)
+		}
+	}
+}
+
+// Runs the same checks over the Bundle as the admission webhooks would,
+// and checks that each resource is only defined once
+func (b *Bundle) validate() error {
+	seen := map[string]bool{}
+	unique := func(kind string, key client.ObjectKey) error {
+		id := kind + " " + key.String()
+		if seen[id] {
+			return fmt.Errorf("%v is defined more than once", id)
+		}
+		seen[id] = true
+		return nil
+	}
+
+	for _, distro := range b.Distributions {
+		if err := unique("Distribution", client.ObjectKeyFromObject(&distro)); err != nil {
+			return err
+		}
+		if errs := webhook.ValidateDistribution(&distro); len(errs) > 0 {
+			return fmt.Errorf("Distribution %v/%v: %w", distro.Namespace, distro.Name, errs.ToAggregate())
+		}
+	}
+	for _, class := range b.DistributionClasses {
+		if err := unique("DistributionClass", client.ObjectKeyFromObject(&class)); err != nil {
+			return err
+		}
+		if errs := webhook.ValidateClassSpec(&class.Spec, false); len(errs) > 0 {
+			return fmt.Errorf("DistributionClass %v/%v: %w", class.Namespace, class.Name, errs.ToAggregate())
+		}
+	}
+	for _, class := range b.ClusterDistributionClasses {
+		if err := unique("ClusterDistributionClass", client.ObjectKeyFromObject(&class)); err != nil {
+			return err
+		}
+		if errs := webhook.ValidateClassSpec(&class.Spec, true); len(errs) > 0 {
+			return fmt.Errorf("ClusterDistributionClass %v: %w", class.Name, errs.ToAggregate())
+		}
+	}
+
+	return nil
+}
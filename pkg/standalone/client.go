@@ -0,0 +1,468 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package standalone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// A Client serves Distributions and DistributionClasses from a Bundle,
+// and keeps the Distributions' status and finalizers in a Store, so that
+// the DistributionReconciler can run in clusters where the CRDs cannot
+// be installed
+//
+// Distributions which are removed from the Bundle are served as though
+// they are being deleted, until the reconciler removes their finalizer.
+//
+// Every other kind of resource is passed through to the wrapped Client.
+type Client struct {
+	client.Client
+
+	source   Source
+	store    Store
+	interval time.Duration
+	events   chan event.GenericEvent
+	log      logr.Logger
+
+	// Whether a Bundle without any Distributions may replace one which
+	// had some. Otherwise, this is assumed to be a mistake (eg an empty
+	// ConfigMap), and the last Bundle is kept.
+	allowEmpty bool
+
+	lock sync.Mutex
+
+	// Set once the first Bundle has been loaded. Until then, only the
+	// Distributions in the State are known about, and none of them are
+	// considered to have been deleted.
+	loaded bool
+
+	distributions map[client.ObjectKey]api.Distribution
+	classes       map[string]api.DistributionClassSpec
+	state         *State
+}
+
+func NewClient(
+	c client.Client,
+	source Source,
+	store Store,
+	interval time.Duration,
+	allowEmpty bool,
+	logger logr.Logger,
+) *Client {
+	return &Client{
+		Client:     c,
+		source:     source,
+		store:      store,
+		interval:   interval,
+		events:     make(chan event.GenericEvent),
+		allowEmpty: allowEmpty,
+		log:        logger,
+		state:      &State{},
+	}
+}
+
+// Events are sent on this channel for each Distribution which needs to
+// be reconciled
+func (c *Client) Events() <-chan event.GenericEvent {
+	return c.events
+}
+
+// Loads the State, and then reloads the Bundle every interval, queuing
+// each of its Distributions (and any which have been removed from it)
+// to be reconciled
+//
+// This makes the Client a manager.Runnable. As it requires leader
+// election, only one replica will write to the Store at a time.
+func (c *Client) Start(ctx context.Context) error {
+	state, err := c.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to load state: %w", err)
+	}
+
+	c.lock.Lock()
+	c.state = state
+	c.lock.Unlock()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.reload(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Loads the Bundle and queues all of the Distributions
+//
+// If the Bundle cannot be loaded, the last one is kept, rather than
+// treating all of its Distributions as having been deleted. The same
+// goes for an empty Bundle while there are still Distributions in the
+// State, unless allowEmpty is set.
+func (c *Client) reload(ctx context.Context) {
+	bundle, err := c.source.Load(ctx)
+	if err != nil {
+		c.log.Error(err, "Unable to load bundle")
+		return
+	}
+
+	c.lock.Lock()
+	if len(bundle.Distributions) == 0 && len(c.state.Distributions) > 0 && !c.allowEmpty {
+		c.lock.Unlock()
+		c.log.Info(
+			"Bundle has no Distributions, keeping the last one. Set --allow-empty-bundle to delete them all",
+			"tracked", len(c.state.Distributions),
+		)
+		return
+	}
+
+	c.distributions = map[client.ObjectKey]api.Distribution{}
+	for _, distro := range bundle.Distributions {
+		c.distributions[client.ObjectKeyFromObject(&distro)] = distro
+	}
+	c.classes = map[string]api.DistributionClassSpec{}
+	for _, class := range bundle.DistributionClasses {
+		c.classes[classId("DistributionClass", class.Namespace, class.Name)] = class.Spec
+	}
+	for _, class := range bundle.ClusterDistributionClasses {
+		c.classes[classId("ClusterDistributionClass", "", class.Name)] = class.Spec
+	}
+	c.loaded = true
+	keys := c.keys()
+	c.lock.Unlock()
+
+	c.log.V(1).Info("Loaded bundle", "distributions", len(bundle.Distributions))
+
+	for _, key := range keys {
+		distro := &api.Distribution{}
+		distro.SetNamespace(key.Namespace)
+		distro.SetName(key.Name)
+
+		select {
+		case c.events <- event.GenericEvent{Object: distro}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Returns the keys of all of the Distributions in the Bundle, or in
+// the State
+func (c *Client) keys() []client.ObjectKey {
+	keys := []client.ObjectKey{}
+	for key := range c.distributions {
+		keys = append(keys, key)
+	}
+	for id := range c.state.Distributions {
+		parts := strings.SplitN(id, "/", 2)
+		key := client.ObjectKey{Namespace: parts[0], Name: parts[1]}
+		if _, ok := c.distributions[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Returns the current version of a Distribution, combining its spec
+// from the Bundle with its status from the State
+//
+// The Distribution's generation is increased whenever its spec differs
+// from the one last saved in the State.
+func (c *Client) distribution(key client.ObjectKey) (api.Distribution, bool) {
+	tracked, isTracked := c.state.Distributions[key.String()]
+	desired, inBundle := c.distributions[key]
+
+	if !inBundle {
+		if isTracked && c.loaded && tracked.DeletionTimestamp.IsZero() {
+			now := metav1.Now()
+			tracked.DeletionTimestamp = &now
+			c.state.Distributions[key.String()] = tracked
+		}
+
+		return *tracked.DeepCopy(), isTracked
+	}
+
+	distro := desired.DeepCopy()
+	if !isTracked {
+		distro.Generation = 1
+		distro.CreationTimestamp = metav1.Now()
+		return *distro, true
+	}
+
+	distro.Generation = tracked.Generation
+	distro.CreationTimestamp = tracked.CreationTimestamp
+	distro.Finalizers = tracked.Finalizers
+	distro.Status = *tracked.Status.DeepCopy()
+	if !sameSpec(tracked.Spec, distro.Spec) {
+		distro.Generation++
+	}
+
+	return *distro, true
+}
+
+// Compares two DistributionSpecs by their JSON, so that empty and nil
+// fields are treated the same once they have been through the Store
+func sameSpec(a, b api.DistributionSpec) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// Returns the spec of the given class, falling back to the copy kept in
+// the State if it has been removed from the Bundle
+func (c *Client) class(id string) (api.DistributionClassSpec, bool) {
+	if spec, ok := c.classes[id]; ok {
+		return spec, true
+	}
+
+	spec, ok := c.state.Classes[id]
+	return spec, ok
+}
+
+// Returns the id of a class, as used in the State
+func classId(kind, namespace, name string) string {
+	if kind == "ClusterDistributionClass" {
+		return kind + "/" + name
+	}
+
+	return kind + "/" + namespace + "/" + name
+}
+
+// Returns the id of the class the Distribution uses
+func distributionClassId(distro api.Distribution) string {
+	ref := distro.Spec.DistributionClassRef
+	return classId(ref.Kind, distro.Namespace, ref.Name)
+}
+
+// Saves the given version of a Distribution to the Store, or removes it
+// if it has been deleted and no longer has a finalizer
+//
+// A copy of its class is saved along with it. Copies of classes which
+// are no longer used are removed.
+func (c *Client) save(ctx context.Context, distro api.Distribution) error {
+	if c.state.Distributions == nil {
+		c.state.Distributions = map[string]api.Distribution{}
+	}
+
+	id := client.ObjectKeyFromObject(&distro).String()
+	if !distro.DeletionTimestamp.IsZero() && len(distro.Finalizers) == 0 {
+		delete(c.state.Distributions, id)
+	} else {
+		c.state.Distributions[id] = distro
+	}
+
+	classes := map[string]api.DistributionClassSpec{}
+	for _, tracked := range c.state.Distributions {
+		if spec, ok := c.class(distributionClassId(tracked)); ok {
+			classes[distributionClassId(tracked)] = spec
+		}
+	}
+	c.state.Classes = classes
+
+	return c.store.Save(ctx, c.state)
+}
+
+func (c *Client) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch obj := obj.(type) {
+	case *api.Distribution:
+		distro, ok := c.distribution(key)
+		if !ok {
+			return notFound("distributions", key.Name)
+		}
+		distro.DeepCopyInto(obj)
+	case *api.DistributionClass:
+		spec, ok := c.class(classId("DistributionClass", key.Namespace, key.Name))
+		if !ok {
+			return notFound("distributionclasses", key.Name)
+		}
+		obj.SetNamespace(key.Namespace)
+		obj.SetName(key.Name)
+		spec.DeepCopyInto(&obj.Spec)
+	case *api.ClusterDistributionClass:
+		spec, ok := c.class(classId("ClusterDistributionClass", "", key.Name))
+		if !ok {
+			return notFound("clusterdistributionclasses", key.Name)
+		}
+		obj.SetName(key.Name)
+		spec.DeepCopyInto(&obj.Spec)
+	default:
+		return c.Client.Get(ctx, key, obj)
+	}
+
+	return nil
+}
+
+func (c *Client) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	distros, ok := list.(*api.DistributionList)
+	if !ok {
+		return c.Client.List(ctx, list, opts...)
+	}
+
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	distros.Items = nil
+	for _, key := range c.keys() {
+		if listOpts.Namespace != "" && key.Namespace != listOpts.Namespace {
+			continue
+		}
+		if distro, ok := c.distribution(key); ok {
+			distros.Items = append(distros.Items, distro)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*api.Distribution); ok {
+		return notSupported("distributions", "create")
+	}
+
+	dropDistributionOwners(obj)
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *Client) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if _, ok := obj.(*api.Distribution); ok {
+		return notSupported("distributions", "delete")
+	}
+
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+// Only a Distribution's finalizers can be updated, as the rest of it
+// comes from the Bundle
+func (c *Client) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	distro, ok := obj.(*api.Distribution)
+	if !ok {
+		dropDistributionOwners(obj)
+		return c.Client.Update(ctx, obj, opts...)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	current, ok := c.distribution(client.ObjectKeyFromObject(distro))
+	if !ok {
+		return notFound("distributions", distro.Name)
+	}
+	current.Finalizers = distro.Finalizers
+
+	return c.save(ctx, current)
+}
+
+// Distributions cannot be patched, as they come from the Bundle
+//
+// This is only used to remove the promote annotation, which has to be
+// removed from the Bundle instead, so it is ignored.
+func (c *Client) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if distro, ok := obj.(*api.Distribution); ok {
+		c.log.V(1).Info("Ignoring patch to bundled Distribution", "distribution", client.ObjectKeyFromObject(distro))
+		return nil
+	}
+
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *Client) Status() client.StatusWriter {
+	return statusWriter{c}
+}
+
+// Saves Distributions' status to the Store, and passes everything else
+// through to the wrapped Client
+type statusWriter struct {
+	c *Client
+}
+
+func (w statusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	distro, ok := obj.(*api.Distribution)
+	if !ok {
+		return w.c.Client.Status().Update(ctx, obj, opts...)
+	}
+
+	w.c.lock.Lock()
+	defer w.c.lock.Unlock()
+
+	current, ok := w.c.distribution(client.ObjectKeyFromObject(distro))
+	if !ok {
+		return notFound("distributions", distro.Name)
+	}
+	distro.Status.DeepCopyInto(&current.Status)
+
+	if err := w.c.save(ctx, current); err != nil {
+		w.c.log.Error(err, "Unable to save state", "distribution", client.ObjectKeyFromObject(distro))
+		return err
+	}
+
+	return nil
+}
+
+func (w statusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if _, ok := obj.(*api.Distribution); ok {
+		return notSupported("distributions/status", "patch")
+	}
+
+	return w.c.Client.Status().Patch(ctx, obj, patch, opts...)
+}
+
+// Removes any owner references to Distributions, as they do not exist
+// in the api-server, so the references would be rejected
+func dropDistributionOwners(obj client.Object) {
+	var refs []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.APIVersion != api.GroupVersion.String() {
+			refs = append(refs, ref)
+		}
+	}
+
+	obj.SetOwnerReferences(refs)
+}
+
+func notFound(resource, name string) error {
+	return apierrors.NewNotFound(api.GroupVersion.WithResource(resource).GroupResource(), name)
+}
+
+func notSupported(resource, action string) error {
+	return apierrors.NewMethodNotSupported(api.GroupVersion.WithResource(resource).GroupResource(), action)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package standalone
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// The key in the state Secret which holds the State
+const stateKey = "state.json"
+
+// The State is everything the controller needs to remember about the
+// Distributions it manages, which would normally be kept in their
+// status (eg the ExternalId and certificate ARN)
+type State struct {
+	// The last known version of each Distribution, keyed by
+	// <namespace>/<name>, including its status and finalizers
+	//
+	// Distributions are kept here after they are removed from the
+	// Bundle, until their external resources have been deleted.
+	Distributions map[string]api.Distribution `json:"distributions,omitempty"`
+
+	// Copies of the classes used by the Distributions above, keyed by
+	// <kind>/<namespace>/<name>, so that they can still be deleted if
+	// their class is removed from the Bundle at the same time
+	Classes map[string]api.DistributionClassSpec `json:"classes,omitempty"`
+}
+
+// A Store persists the State between restarts
+type Store interface {
+	// Loads the State, returning an empty State if none has been saved
+	Load(ctx context.Context) (*State, error)
+
+	Save(ctx context.Context, state *State) error
+}
+
+// Keeps the State in a local file, such as on a PersistentVolume
+type FileStore struct {
+	Path string
+}
+
+func (s FileStore) Load(ctx context.Context) (*State, error) {
+	state := &State{}
+
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return state, json.Unmarshal(data, state)
+}
+
+// Writes the State to a temporary file, which is then moved into place,
+// so that a crash part way through cannot leave a truncated file
+func (s FileStore) Save(ctx context.Context, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), "."+filepath.Base(s.Path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// Keeps the State in a Secret, which is created if it does not exist
+//
+// The Client should read directly from the api-server, as a cached
+// read straight after a Save would be likely to conflict.
+type SecretStore struct {
+	Client client.Client
+	Key    client.ObjectKey
+}
+
+func (s SecretStore) Load(ctx context.Context) (*State, error) {
+	state := &State{}
+
+	var secret corev1.Secret
+	if err := s.Client.Get(ctx, s.Key, &secret); apierrors.IsNotFound(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if data, ok := secret.Data[stateKey]; ok {
+		return state, json.Unmarshal(data, state)
+	}
+
+	return state, nil
+}
+
+func (s SecretStore) Save(ctx context.Context, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	secret := corev1.Secret{}
+	secret.SetName(s.Key.Name)
+	secret.SetNamespace(s.Key.Namespace)
+
+	_, err = controllerutil.CreateOrUpdate(ctx, s.Client, &secret, func() error {
+		secret.Data = map[string][]byte{stateKey: data}
+		return nil
+	})
+
+	return err
+}
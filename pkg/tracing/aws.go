@@ -0,0 +1,80 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"gitlab.com/redcoat/cdn-manager/pkg/util"
+)
+
+// The names of the handlers added to AWS sessions
+const (
+	awsStartHandlerName = "cdn-manager/tracing/start"
+	awsEndHandlerName   = "cdn-manager/tracing/end"
+)
+
+// Adds handlers to the given AWS session so that every API call made
+// with it is recorded as a span
+//
+// Spans are children of the context given to the SDK's WithContext
+// methods. Calling this more than once on the same session has no
+// further effect.
+func InstrumentAwsSession(sess *session.Session, provider string) {
+	start := request.NamedHandler{
+		Name: awsStartHandlerName,
+		Fn: func(r *request.Request) {
+			service := r.ClientInfo.ServiceID
+			operation := util.AwsOperationName(r.Operation.Name)
+			ctx, _ := Start(
+				r.Context(),
+				service+"."+operation,
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCServiceKey.String(service),
+				semconv.RPCMethodKey.String(operation),
+				AttributeProvider.String(provider),
+			)
+			r.SetContext(ctx)
+		},
+	}
+
+	end := request.NamedHandler{
+		Name: awsEndHandlerName,
+		Fn: func(r *request.Request) {
+			span := trace.SpanFromContext(r.Context())
+			if r.RequestID != "" {
+				span.SetAttributes(attribute.String("aws.request_id", r.RequestID))
+			}
+			if r.HTTPResponse != nil {
+				span.SetAttributes(semconv.HTTPStatusCodeKey.Int(r.HTTPResponse.StatusCode))
+			}
+
+			End(span, &r.Error)
+		},
+	}
+
+	if !sess.Handlers.Validate.Swap(awsStartHandlerName, start) {
+		sess.Handlers.Validate.PushFrontNamed(start)
+	}
+	if !sess.Handlers.Complete.Swap(awsEndHandlerName, end) {
+		sess.Handlers.Complete.PushBackNamed(end)
+	}
+}
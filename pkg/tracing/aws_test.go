@@ -0,0 +1,130 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Sets up an in-process collector as the global TracerProvider
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func TestInstrumentAwsSession(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-amz-request-id", "test-request")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<?xml version="1.0"?><ErrorResponse><Error>` +
+			`<Code>NoSuchDistribution</Code><Message>Not found</Message>` +
+			`</Error></ErrorResponse>`))
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	InstrumentAwsSession(sess, "cloudfront")
+	// Instrumenting twice must not create duplicate spans
+	InstrumentAwsSession(sess, "cloudfront")
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, err := cloudfront.New(sess).GetDistributionWithContext(ctx, &cloudfront.GetDistributionInput{
+		Id: aws.String("E2QWRUHAPOMQZL"),
+	})
+	parent.End()
+
+	if err == nil {
+		t.Fatal("expected the request to fail")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %v", len(spans))
+	}
+
+	call := spans[0]
+	if call.Name() != "CloudFront.GetDistribution" {
+		t.Errorf("unexpected span name %q", call.Name())
+	}
+	if call.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the API call span to be a child of the parent span")
+	}
+	if call.Status().Code != codes.Error {
+		t.Errorf("expected an error status, got %v", call.Status().Code)
+	}
+
+	attributes := map[string]string{}
+	for _, attr := range call.Attributes() {
+		attributes[string(attr.Key)] = attr.Value.Emit()
+	}
+	expected := map[string]string{
+		"rpc.system":       "aws-api",
+		"rpc.method":       "GetDistribution",
+		"cdn.provider":     "cloudfront",
+		"aws.request_id":   "test-request",
+		"http.status_code": "404",
+	}
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("expected attribute %v to be %q, got %q", key, value, attributes[key])
+		}
+	}
+}
+
+func TestEndRecordsError(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	err := func() (err error) {
+		_, span := Start(context.Background(), "failing")
+		defer End(span, &err)
+
+		return http.ErrNoLocation
+	}()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %v", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error || spans[0].Status().Description != err.Error() {
+		t.Errorf("expected the error to be recorded, got %+v", spans[0].Status())
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing sets up OpenTelemetry tracing for the controller
+//
+// Spans are always created via the global TracerProvider. If tracing has
+// not been set up, this is a no-op provider, so instrumented code does
+// not need to check whether tracing is enabled.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the instrumentation library, as reported on every span
+const instrumentationName = "gitlab.com/redcoat/cdn-manager"
+
+// Attribute keys used on spans
+const (
+	AttributeDistribution = attribute.Key("cdn.distribution")
+	AttributeClass        = attribute.Key("cdn.class")
+	AttributeProvider     = attribute.Key("cdn.provider")
+	AttributeExternalId   = attribute.Key("cdn.external_id")
+)
+
+// Options for exporting traces
+type Options struct {
+	// The host:port of the OTLP gRPC collector. If this is empty, tracing
+	// is disabled.
+	Endpoint string
+
+	// Connect to the collector without TLS
+	Insecure bool
+
+	// The fraction of traces to sample, between 0 and 1
+	SampleRatio float64
+}
+
+// Sets up the global TracerProvider to export spans to an OTLP collector
+//
+// The returned function flushes any remaining spans and should be called
+// before the process exits.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(opts.SampleRatio),
+		)),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("cdn-manager"),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Starts a new span, as a child of any span in the given context
+func Start(
+	ctx context.Context,
+	name string,
+	attributes ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(
+		ctx,
+		name,
+		trace.WithAttributes(attributes...),
+	)
+}
+
+// Records the error (if any) on the span, and ends it
+//
+// This is designed to be deferred with a pointer to a named error
+// return value:
+//
+//   ctx, span := tracing.Start(ctx, "Name")
+//   defer tracing.End(span, &err)
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"regexp"
+)
+
+var apiVersionSuffix = regexp.MustCompile(`\d{4}_\d{2}_\d{2}$`)
+
+// Returns the name of an AWS SDK operation without its API version
+//
+// Some services (eg CloudFront) suffix their operation names with the
+// API version, such as "GetDistribution2020_05_31".
+func AwsOperationName(operation string) string {
+	return apiVersionSuffix.ReplaceAllString(operation, "")
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package util
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -38,3 +40,31 @@ func ObjectKeyFromString(key string) *client.ObjectKey {
 		Name:      parts[1],
 	}
 }
+
+// Converts a comma separated list of <key>=<namespace>/<name> pairs into
+// a map of client.ObjectKeys
+func ObjectKeyMapFromString(value string) (map[string]client.ObjectKey, error) {
+	keys := map[string]client.ObjectKey{}
+	for _, pair := range SplitList(value) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || !strings.Contains(parts[1], "/") {
+			return nil, fmt.Errorf("%q is not in the form <key>=<namespace>/<name>", pair)
+		}
+
+		keys[parts[0]] = *ObjectKeyFromString(parts[1])
+	}
+
+	return keys, nil
+}
+
+// Splits a comma separated list, dropping any empty items
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
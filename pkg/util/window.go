@@ -0,0 +1,51 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+)
+
+// Checks if the given maintenance window is open at the given time
+//
+// If it is not, the time it next opens is also returned. A nil window
+// is always open.
+func MaintenanceWindowOpen(
+	window *api.MaintenanceWindow,
+	now time.Time,
+) (bool, time.Time, error) {
+	if window == nil {
+		return true, now, nil
+	}
+
+	schedule, err := cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return false, now, err
+	}
+
+	// The window is open if it last opened within its duration, which is
+	// the case if it next opens (counting from that long ago) before now
+	if start := schedule.Next(now.Add(-window.Duration.Duration)); !start.After(now) {
+		return true, now, nil
+	}
+
+	return false, schedule.Next(now), nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	cfapi "gitlab.com/redcoat/cdn-manager/pkg/provider/cloudfront/api/v1alpha1"
+)
+
+// The HTTP methods which can be given in a class' supportedMethods
+var supportedMethods = []string{"GET", "HEAD", "OPTIONS", "POST", "PUT", "PATCH", "DELETE"}
+
+// Decodes the DistributionClass or ClusterDistributionClass in the
+// request, returning it along with its spec
+//
+// Both kinds share the same spec, so are defaulted and validated in the
+// same way. ClusterDistributionClasses are not namespaced, so any
+// resources they refer to must give their namespace.
+func decodeClass(
+	decoder *admission.Decoder,
+	req admission.Request,
+) (obj runtime.Object, spec *api.DistributionClassSpec, clustered bool, err error) {
+	if req.Kind.Kind == "ClusterDistributionClass" {
+		var class api.ClusterDistributionClass
+		err = decoder.Decode(req, &class)
+		return &class, &class.Spec, true, err
+	}
+
+	var class api.DistributionClass
+	err = decoder.Decode(req, &class)
+	return &class, &class.Spec, false, err
+}
+
+// Fills in the defaults for DistributionClasses and
+// ClusterDistributionClasses as they are created or updated
+type ClassDefaulter struct {
+	decoder *admission.Decoder
+}
+
+func (d *ClassDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if isDelete(req) {
+		return admission.Allowed("")
+	}
+
+	obj, spec, _, err := decodeClass(d.decoder, req)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	DefaultClassSpec(spec)
+
+	return patchResponse(req, obj)
+}
+
+// Sets the defaults for any fields of the class' spec which have not
+// been given
+func DefaultClassSpec(spec *api.DistributionClassSpec) {
+	if spec.DeletionPolicy == "" {
+		spec.DeletionPolicy = api.DeletionPolicyDelete
+	}
+	if spec.DriftPolicy == "" {
+		spec.DriftPolicy = api.DriftPolicyCorrect
+	}
+
+	if cf := spec.Providers.CloudFront; cf != nil {
+		if cf.SSLMode == "" {
+			cf.SSLMode = "sni-only"
+		}
+		if len(cf.SupportedMethods) == 0 {
+			cf.SupportedMethods = []string{"GET", "HEAD"}
+		}
+	}
+}
+
+// Rejects DistributionClasses and ClusterDistributionClasses which the
+// controller would not be able to use
+type ClassValidator struct {
+	decoder *admission.Decoder
+}
+
+func (v *ClassValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if isDelete(req) {
+		return admission.Allowed("")
+	}
+
+	_, spec, clustered, err := decodeClass(v.decoder, req)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	return validationResponse(ValidateClassSpec(spec, clustered))
+}
+
+// Checks a DistributionClass or ClusterDistributionClass' spec
+func ValidateClassSpec(spec *api.DistributionClassSpec, clustered bool) field.ErrorList {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+
+	if window := spec.MaintenanceWindow; window != nil {
+		windowPath := path.Child("maintenanceWindow")
+		if _, err := cron.ParseStandard(window.Schedule); err != nil {
+			errs = append(errs, field.Invalid(windowPath.Child("schedule"), window.Schedule, err.Error()))
+		}
+		if window.Duration.Duration <= 0 {
+			errs = append(errs, field.Invalid(windowPath.Child("duration"), window.Duration.String(), "must be positive"))
+		}
+	}
+
+	cf := spec.Providers.CloudFront
+	if cf == nil {
+		return append(errs, field.Required(path.Child("providers"), "at least one provider must be given"))
+	}
+
+	cfPath := path.Child("providers", "cloudfront")
+	if cf.OriginRequestPolicyId != "" && cf.CachePolicyId == "" {
+		errs = append(errs, field.Required(
+			cfPath.Child("cachePolicyId"),
+			"must be given when originRequestPolicyId is",
+		))
+	}
+
+	for i, method := range cf.SupportedMethods {
+		if !contains(supportedMethods, method) {
+			errs = append(errs, field.NotSupported(cfPath.Child("supportedMethods").Index(i), method, supportedMethods))
+		}
+	}
+
+	return append(errs, validateAwsAuth(cfPath.Child("auth"), cf.Auth, clustered)...)
+}
+
+// Checks that at most one way of getting AWS credentials has been given,
+// and that it can be found
+func validateAwsAuth(path *field.Path, auth *cfapi.AwsAuth, clustered bool) field.ErrorList {
+	if auth == nil {
+		return nil
+	}
+
+	var errs field.ErrorList
+	if auth.AccessKeyRef != nil && auth.JWTAuth != nil {
+		errs = append(errs, field.Forbidden(path.Child("jwt"), "cannot be given as well as accessKeyRef"))
+	}
+
+	if !clustered {
+		return errs
+	}
+
+	if ref := auth.AccessKeyRef; ref != nil && ref.Namespace == nil {
+		errs = append(errs, field.Required(
+			path.Child("accessKeyRef", "namespace"),
+			"is required for cluster-scoped classes",
+		))
+	}
+	if jwt := auth.JWTAuth; jwt != nil && jwt.ServiceAccount.Namespace == nil {
+		errs = append(errs, field.Required(
+			path.Child("jwt", "serviceAccount", "namespace"),
+			"is required for cluster-scoped classes",
+		))
+	}
+
+	return errs
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
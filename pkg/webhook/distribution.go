@@ -0,0 +1,280 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	api "gitlab.com/redcoat/cdn-manager/pkg/api/v1alpha1"
+	"gitlab.com/redcoat/cdn-manager/pkg/resolver"
+)
+
+// Fills in the defaults for Distributions as they are created or
+// updated
+type DistributionDefaulter struct {
+	decoder *admission.Decoder
+}
+
+func (d *DistributionDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if isDelete(req) {
+		return admission.Allowed("")
+	}
+
+	var distro api.Distribution
+	if err := d.decoder.Decode(req, &distro); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	DefaultDistribution(&distro)
+
+	return patchResponse(req, &distro)
+}
+
+// Sets the defaults for any fields of the Distribution which have not
+// been given
+func DefaultDistribution(distro *api.Distribution) {
+	origin := &distro.Spec.Origin
+	if origin.HTTPPort == 0 {
+		origin.HTTPPort = 80
+	}
+	if origin.HTTPSPort == 0 {
+		origin.HTTPSPort = 443
+	}
+
+	if tls := distro.Spec.TLS; tls != nil && tls.Mode == "" {
+		tls.Mode = "redirect"
+	}
+}
+
+// Rejects Distributions which the controller would not be able to
+// reconcile
+type DistributionValidator struct {
+	client.Client
+	decoder *admission.Decoder
+}
+
+func (v *DistributionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if isDelete(req) {
+		return admission.Allowed("")
+	}
+
+	var distro api.Distribution
+	if err := v.decoder.Decode(req, &distro); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Updates to a Distribution which is being deleted, or which don't
+	// change its spec (eg the controller adding or removing its
+	// finalizer), are always allowed. Otherwise, a Distribution which no
+	// longer passes validation could never be deleted.
+	if !distro.DeletionTimestamp.IsZero() {
+		return admission.Allowed("")
+	}
+	if req.Operation == admissionv1.Update {
+		var old api.Distribution
+		if err := v.decoder.DecodeRaw(req.OldObject, &old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if equality.Semantic.DeepEqual(old.Spec, distro.Spec) {
+			return admission.Allowed("")
+		}
+	}
+
+	errs := ValidateDistribution(&distro)
+	errs = append(errs, v.validateCertificate(ctx, &distro)...)
+
+	return validationResponse(errs)
+}
+
+// Checks the Distribution's spec, without looking at any of the
+// resources it refers to
+func ValidateDistribution(distro *api.Distribution) field.ErrorList {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+
+	classRef := distro.Spec.DistributionClassRef
+	classPath := spec.Child("distributionClass")
+	if classRef.Kind != "DistributionClass" && classRef.Kind != "ClusterDistributionClass" {
+		errs = append(errs, field.NotSupported(
+			classPath.Child("kind"),
+			classRef.Kind,
+			[]string{"DistributionClass", "ClusterDistributionClass"},
+		))
+	}
+	if classRef.Name == "" {
+		errs = append(errs, field.Required(classPath.Child("name"), ""))
+	}
+
+	seen := map[string]bool{}
+	for i, host := range distro.Spec.Hosts {
+		path := spec.Child("hosts").Index(i)
+		if seen[host] {
+			errs = append(errs, field.Duplicate(path, host))
+		}
+		seen[host] = true
+		errs = append(errs, validateHost(path, host)...)
+	}
+
+	origin := distro.Spec.Origin
+	originPath := spec.Child("origin")
+	if s3 := origin.S3; s3 != nil {
+		if s3.BucketName == "" {
+			errs = append(errs, field.Required(originPath.Child("s3", "bucketName"), ""))
+		}
+		if s3.Region == "" {
+			errs = append(errs, field.Required(originPath.Child("s3", "region"), ""))
+		}
+	} else if origin.Host != "" {
+		errs = append(errs, validateHost(originPath.Child("host"), origin.Host)...)
+	}
+	if ref := origin.TargetRef; ref != nil {
+		refPath := originPath.Child("targetRef")
+		switch ref.Kind {
+		case "Ingress", "Service", "Gateway":
+		default:
+			errs = append(errs, field.NotSupported(
+				refPath.Child("kind"),
+				ref.Kind,
+				[]string{"Ingress", "Service", "Gateway"},
+			))
+		}
+		if ref.Name == "" {
+			errs = append(errs, field.Required(refPath.Child("name"), ""))
+		}
+	}
+	errs = append(errs, validatePort(originPath.Child("httpPort"), origin.HTTPPort)...)
+	errs = append(errs, validatePort(originPath.Child("httpsPort"), origin.HTTPSPort)...)
+
+	if tls := distro.Spec.TLS; tls != nil {
+		if ref := tls.CertificateRef; ref != nil {
+			refPath := spec.Child("tls", "certificateRef")
+			if ref.Kind != "Route" {
+				errs = append(errs, field.NotSupported(refPath.Child("kind"), ref.Kind, []string{"Route"}))
+			}
+			if ref.Name == "" {
+				errs = append(errs, field.Required(refPath.Child("name"), ""))
+			}
+		} else if tls.SecretRef == "" {
+			errs = append(errs, field.Required(spec.Child("tls", "secretName"), "unless certificateRef is given"))
+		}
+	}
+
+	if signed := distro.Spec.SignedURLs; signed != nil && signed.SecretRef == "" {
+		errs = append(errs, field.Required(spec.Child("signedUrls", "secretName"), ""))
+	}
+
+	if rollout := distro.Spec.Rollout; rollout != nil {
+		if (rollout.Header == nil) == (rollout.WeightPercent == 0) {
+			errs = append(errs, field.Invalid(
+				spec.Child("rollout"),
+				"",
+				"exactly one of header or weightPercent must be given",
+			))
+		}
+	}
+
+	if adopt := distro.Spec.Adopt; adopt != nil && adopt.ExternalId == "" {
+		errs = append(errs, field.Required(spec.Child("adopt", "externalId"), ""))
+	}
+
+	return errs
+}
+
+// Checks that a host name is a fully qualified domain name, optionally
+// with a leading wildcard, and not an IP address or host:port pair
+func validateHost(path *field.Path, host string) field.ErrorList {
+	if net.ParseIP(host) != nil {
+		return field.ErrorList{field.Invalid(path, host, "must be a host name, not an IP address")}
+	} else if strings.Contains(host, ":") {
+		return field.ErrorList{field.Invalid(path, host, "must not include a port")}
+	}
+
+	var problems []string
+	if strings.HasPrefix(host, "*.") {
+		problems = validation.IsWildcardDNS1123Subdomain(host)
+	} else {
+		problems = validation.IsDNS1123Subdomain(host)
+	}
+
+	var errs field.ErrorList
+	for _, problem := range problems {
+		errs = append(errs, field.Invalid(path, host, problem))
+	}
+
+	return errs
+}
+
+func validatePort(path *field.Path, port int32) field.ErrorList {
+	if port < 1 || port > 65535 {
+		return field.ErrorList{field.Invalid(path, port, "must be between 1 and 65535")}
+	}
+
+	return nil
+}
+
+// Checks that the Distribution's TLS certificate covers all of its hosts
+//
+// If the certificate cannot be loaded (eg because cert-manager has not
+// issued it yet), this check is skipped, and the controller will report
+// the problem when it tries to use it.
+func (v *DistributionValidator) validateCertificate(
+	ctx context.Context,
+	distro *api.Distribution,
+) field.ErrorList {
+	tls := distro.Spec.TLS
+	if tls == nil || (tls.SecretRef == "" && tls.CertificateRef == nil) {
+		return nil
+	}
+
+	certResolver := resolver.CertificateResolver{Client: v.Client}
+	cert, err := certResolver.ResolveTLS(ctx, distro.Namespace, *tls)
+	if err != nil || cert.Certificate.Parsed == nil {
+		return nil
+	}
+
+	source := "secret " + tls.SecretRef
+	if ref := tls.CertificateRef; ref != nil {
+		source = ref.Kind + " " + ref.Name
+	}
+
+	var errs field.ErrorList
+	parsed := cert.Certificate.Parsed
+	for i, host := range distro.Spec.Hosts {
+		if resolver.CoversHost(parsed.DNSNames, host) {
+			continue
+		}
+
+		errs = append(errs, field.Invalid(
+			field.NewPath("spec", "hosts").Index(i),
+			host,
+			fmt.Sprintf("is not covered by the certificate in %v", source),
+		))
+	}
+
+	return errs
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 Red Coat Development Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// The paths the admission webhooks are served on. These must match the
+// webhook configurations in the Helm chart.
+const (
+	DistributionDefaultPath  = "/mutate-v1alpha1-distribution"
+	DistributionValidatePath = "/validate-v1alpha1-distribution"
+	ClassDefaultPath         = "/mutate-v1alpha1-distributionclass"
+	ClassValidatePath        = "/validate-v1alpha1-distributionclass"
+)
+
+// Registers the defaulting and validating admission webhooks for
+// Distributions, DistributionClasses and ClusterDistributionClasses
+// with the manager's webhook server
+func Register(mgr ctrl.Manager) error {
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+
+	server := mgr.GetWebhookServer()
+	server.Register(DistributionDefaultPath, &webhook.Admission{
+		Handler: &DistributionDefaulter{decoder: decoder},
+	})
+	server.Register(DistributionValidatePath, &webhook.Admission{
+		Handler: &DistributionValidator{decoder: decoder, Client: mgr.GetClient()},
+	})
+	server.Register(ClassDefaultPath, &webhook.Admission{
+		Handler: &ClassDefaulter{decoder: decoder},
+	})
+	server.Register(ClassValidatePath, &webhook.Admission{
+		Handler: &ClassValidator{decoder: decoder},
+	})
+
+	return nil
+}
+
+// Builds a response which patches the object in the request to match
+// the given, defaulted, object
+func patchResponse(req admission.Request, obj runtime.Object) admission.Response {
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// Builds a response which allows the request, unless there were
+// validation errors
+func validationResponse(errs field.ErrorList) admission.Response {
+	if len(errs) > 0 {
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// Checks if the request is for an object being deleted, which does not
+// need to be defaulted or validated
+func isDelete(req admission.Request) bool {
+	return req.Operation == admissionv1.Delete
+}